@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aaron-jencks/gitchbot/storage"
+
+	twitch "github.com/gempir/go-twitch-irc/v4"
+)
+
+// The events that alerts can be created for, templates may use {user} and the substitutions listed
+const (
+	ALERT_SUB   = "sub"     // {months}
+	ALERT_RESUB = "resub"   // {months}, the minimum is the number of months
+	ALERT_GIFT  = "subgift" // {count}, the minimum is the number of gifts
+	ALERT_RAID  = "raid"    // {viewers}, the minimum is the number of viewers
+	ALERT_CHEER = "cheer"   // {bits}, the minimum is the number of bits
+)
+
+// ALERT_BATCH_WINDOW is how long to wait for more gift subs from the same gifter before thanking them
+const ALERT_BATCH_WINDOW = 5 * time.Second
+
+// CreateAlert creates the alert for an event, an existing alert for the event is kept
+func CreateAlert(b Bot, channel, event, template string, minimum int) error {
+	err := b.Storage(channel).CreateAlert(event, template, minimum)
+	if errors.Is(err, storage.ErrAlreadyExists) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("created alert for %s in %s\n", event, channel)
+	return nil
+}
+
+// postAlert fills in the event's template and posts it, if the event has an alert and the amount reaches its minimum
+func postAlert(b Bot, channel, event string, amount int, values map[string]string) error {
+	backer := b.Storage(channel)
+	if backer == nil {
+		return nil
+	}
+	template, minimum, err := backer.RetrieveAlert(event)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if amount < minimum {
+		return nil
+	}
+	for key, value := range values {
+		template = strings.ReplaceAll(template, "{"+key+"}", value)
+	}
+	return b.Post(channel, template, PRIORITY_NORMAL)
+}
+
+// submitAlert posts the alert from the workers rather than the irc connection's goroutine, since it reads from storage
+func submitAlert(client Bot, channel, event string, amount int, values map[string]string) {
+	ok := client.Submit(func() {
+		err := postAlert(client, channel, event, amount, values)
+		if err != nil {
+			log.Printf("failed to post %s alert in %s: %v\n", event, channel, err)
+		}
+	})
+	if !ok {
+		log.Printf("dropping %s alert in %s, too many commands are being handled\n", event, channel)
+	}
+}
+
+func msgParamInt(message twitch.UserNoticeMessage, param string) int {
+	value, err := strconv.Atoi(message.MsgParams[param])
+	if err != nil {
+		return 0
+	}
+	return value
+}
+
+type giftBatch struct {
+	user     string
+	count    int
+	expected int // individual gifts still to come from a mystery gift that was already counted
+	timer    *time.Timer
+}
+
+// giftBatcher combines gift subs from the same gifter into a single alert,
+// so that a gift bomb of 50 subs is thanked once rather than 50 times.
+type giftBatcher struct {
+	lock    sync.Mutex
+	batches map[string]*giftBatch
+}
+
+func (gb *giftBatcher) add(b Bot, channel, userID, user string, count int, mystery bool) {
+	gb.lock.Lock()
+	defer gb.lock.Unlock()
+	key := channel + "\x00" + userID
+	batch, ok := gb.batches[key]
+	if !ok {
+		batch = &giftBatch{user: user}
+		gb.batches[key] = batch
+		batch.timer = time.AfterFunc(ALERT_BATCH_WINDOW, func() {
+			gb.flush(b, channel, key)
+		})
+	} else {
+		batch.timer.Reset(ALERT_BATCH_WINDOW)
+	}
+	if mystery {
+		batch.count += count
+		batch.expected += count
+	} else if batch.expected > 0 {
+		batch.expected--
+	} else {
+		batch.count += count
+	}
+}
+
+func (gb *giftBatcher) flush(b Bot, channel, key string) {
+	gb.lock.Lock()
+	batch, ok := gb.batches[key]
+	delete(gb.batches, key)
+	gb.lock.Unlock()
+	if !ok || batch.count == 0 {
+		return
+	}
+	err := postAlert(b, channel, ALERT_GIFT, batch.count, map[string]string{
+		"user":  batch.user,
+		"count": strconv.Itoa(batch.count),
+	})
+	if err != nil {
+		log.Printf("failed to post gift sub alert in %s: %v\n", channel, err)
+	}
+}
+
+// CreateAlertHandlers subscribes to the events that alerts are posted for, in every channel
+func CreateAlertHandlers(b Bot) {
+	gifts := &giftBatcher{
+		batches: map[string]*giftBatch{},
+	}
+
+	Subscribe(b.Events(), func(client Bot, message twitch.UserNoticeMessage) {
+		channel := normalizeChannel(message.Channel)
+		user := message.User.DisplayName
+		switch message.MsgID {
+		case "sub":
+			months := msgParamInt(message, "msg-param-cumulative-months")
+			submitAlert(client, channel, ALERT_SUB, months, map[string]string{
+				"user":   user,
+				"months": strconv.Itoa(months),
+			})
+		case "resub":
+			months := msgParamInt(message, "msg-param-cumulative-months")
+			submitAlert(client, channel, ALERT_RESUB, months, map[string]string{
+				"user":   user,
+				"months": strconv.Itoa(months),
+			})
+		case "subgift", "anonsubgift":
+			gifts.add(client, channel, message.User.ID, user, 1, false)
+		case "submysterygift", "anonsubmysterygift":
+			gifts.add(client, channel, message.User.ID, user, msgParamInt(message, "msg-param-mass-gift-count"), true)
+		case "raid":
+			viewers := msgParamInt(message, "msg-param-viewerCount")
+			submitAlert(client, channel, ALERT_RAID, viewers, map[string]string{
+				"user":    message.MsgParams["msg-param-displayName"],
+				"viewers": strconv.Itoa(viewers),
+			})
+		}
+	})
+
+	Subscribe(b.Events(), func(client Bot, message twitch.PrivateMessage) {
+		if message.Bits <= 0 {
+			return
+		}
+		submitAlert(client, normalizeChannel(message.Channel), ALERT_CHEER, message.Bits, map[string]string{
+			"user": message.User.DisplayName,
+			"bits": strconv.Itoa(message.Bits),
+		})
+	})
+}
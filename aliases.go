@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/aaron-jencks/gitchbot/storage"
+)
+
+func CreateAlias(b Bot, channel, alias, target string) error {
+	if b.HandlerExists(channel, alias) {
+		return fmt.Errorf("failed to create alias %s in %s, handler already exists", alias, channel)
+	}
+	backing := b.Storage(channel)
+	err := backing.CreateAlias(alias, target)
+	if err != nil && !errors.Is(err, storage.ErrAlreadyExists) {
+		return err
+	}
+	// an existing alias is kept, so register whatever is actually stored
+	target, err = backing.RetrieveAlias(alias)
+	if err != nil {
+		return err
+	}
+	b.RegisterAlias(channel, alias, target)
+	log.Printf("created new alias %s -> %s in %s\n", alias, target, channel)
+	return nil
+}
+
+func LoadAliases(b Bot, channel string) error {
+	aliases, err := b.Storage(channel).ListAliases()
+	if err != nil {
+		return err
+	}
+	for alias, target := range aliases {
+		b.RegisterAlias(channel, alias, target)
+		log.Printf("loaded alias %s -> %s in %s\n", alias, target, channel)
+	}
+	return nil
+}
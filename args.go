@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+type ArgType int
+
+const (
+	ARG_WORD     ArgType = iota // a single word
+	ARG_STRING                  // a "quoted string", or a single word
+	ARG_TEXT                    // everything that remains on the line
+	ARG_INT                     // a whole number
+	ARG_DURATION                // a duration such as 5m or 1h30m
+	ARG_USER                    // a user, with or without the leading @
+	ARG_FLAG                    // a --flag that may appear anywhere
+)
+
+// ArgSpec describes a single argument of a command
+type ArgSpec struct {
+	Name     string
+	Type     ArgType
+	Optional bool
+	Choices  []string // restricts a word to one of these values
+	MinLen   int      // minimum length of strings and text, in characters
+	MaxLen   int      // maximum length of strings and text, in characters, zero means no limit
+}
+
+// ArgSchema describes the arguments of a command in the order they are given
+type ArgSchema []ArgSpec
+
+// Args holds the parsed arguments of a command by name
+type Args map[string]interface{}
+
+func (a Args) Has(name string) bool {
+	_, ok := a[name]
+	return ok
+}
+
+func (a Args) String(name string) string {
+	value, _ := a[name].(string)
+	return value
+}
+
+func (a Args) Int(name string) int {
+	value, _ := a[name].(int)
+	return value
+}
+
+func (a Args) Duration(name string) time.Duration {
+	value, _ := a[name].(time.Duration)
+	return value
+}
+
+func (a Args) Flag(name string) bool {
+	value, _ := a[name].(bool)
+	return value
+}
+
+func (spec ArgSpec) usage() string {
+	var result string
+	switch spec.Type {
+	case ARG_FLAG:
+		return fmt.Sprintf("[--%s]", spec.Name)
+	case ARG_STRING:
+		result = fmt.Sprintf("\"%s\"", spec.Name)
+	case ARG_USER:
+		result = "@" + spec.Name
+	case ARG_INT:
+		result = fmt.Sprintf("<%s:number>", spec.Name)
+	case ARG_DURATION:
+		result = fmt.Sprintf("<%s:duration>", spec.Name)
+	default:
+		if len(spec.Choices) > 0 {
+			result = fmt.Sprintf("<%s>", strings.Join(spec.Choices, "|"))
+		} else {
+			result = fmt.Sprintf("<%s>", spec.Name)
+		}
+	}
+	if spec.MaxLen > 0 {
+		result += fmt.Sprintf(" (%d-%d chars)", spec.MinLen, spec.MaxLen)
+	} else if spec.MinLen > 0 {
+		result += fmt.Sprintf(" (%d+ chars)", spec.MinLen)
+	}
+	if spec.Optional {
+		result = "[" + result + "]"
+	}
+	return result
+}
+
+// Usage generates the usage text for a command using this schema, e.g. "title <text>"
+func (schema ArgSchema) Usage(command string) string {
+	parts := []string{command}
+	for _, spec := range schema {
+		parts = append(parts, spec.usage())
+	}
+	return strings.Join(parts, " ")
+}
+
+type argToken struct {
+	text   string
+	quoted bool
+	rest   string // the unparsed line starting at this token
+	flag   bool
+}
+
+// tokenizeArgs splits the arguments on whitespace, keeping "quoted strings" together
+func tokenizeArgs(line string) (tokens []argToken, err error) {
+	rest := strings.TrimLeftFunc(line, unicode.IsSpace)
+	for rest != "" {
+		token := argToken{rest: rest}
+		if rest[0] == '"' {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("a quote is missing its closing \"")
+			}
+			token.text = rest[1 : end+1]
+			token.quoted = true
+			rest = rest[end+2:]
+		} else {
+			end := strings.IndexFunc(rest, unicode.IsSpace)
+			if end < 0 {
+				end = len(rest)
+			}
+			token.text = rest[:end]
+			rest = rest[end:]
+		}
+		tokens = append(tokens, token)
+		rest = strings.TrimLeftFunc(rest, unicode.IsSpace)
+	}
+	return
+}
+
+func (spec ArgSpec) checkLength(value string) error {
+	length := utf8.RuneCountInString(value)
+	if spec.MaxLen == 0 {
+		if length < spec.MinLen {
+			return fmt.Errorf("%s must be at least %d characters", spec.Name, spec.MinLen)
+		}
+		return nil
+	}
+	if length < spec.MinLen || length > spec.MaxLen {
+		return fmt.Errorf("%s must be between %d and %d characters", spec.Name, spec.MinLen, spec.MaxLen)
+	}
+	return nil
+}
+
+func (spec ArgSpec) parse(token argToken) (interface{}, error) {
+	switch spec.Type {
+	case ARG_INT:
+		value, err := strconv.Atoi(token.text)
+		if err != nil {
+			return nil, fmt.Errorf("\"%s\" is not a number for %s", token.text, spec.Name)
+		}
+		return value, nil
+	case ARG_DURATION:
+		value, err := time.ParseDuration(token.text)
+		if err != nil {
+			return nil, fmt.Errorf("\"%s\" is not a duration (like 5m or 1h30m) for %s", token.text, spec.Name)
+		}
+		return value, nil
+	case ARG_USER:
+		value := strings.TrimPrefix(token.text, "@")
+		if value == "" {
+			return nil, fmt.Errorf("%s must be a user", spec.Name)
+		}
+		return value, nil
+	case ARG_STRING:
+		return token.text, spec.checkLength(token.text)
+	case ARG_TEXT:
+		value := strings.TrimSpace(token.rest)
+		return value, spec.checkLength(value)
+	}
+	if len(spec.Choices) > 0 {
+		for _, choice := range spec.Choices {
+			if strings.EqualFold(choice, token.text) {
+				return choice, nil
+			}
+		}
+		return nil, fmt.Errorf("%s must be one of %s", spec.Name, strings.Join(spec.Choices, ", "))
+	}
+	return token.text, nil
+}
+
+// textWithoutFlags returns the line from the token onwards with any flags cut out of it,
+// so that the text keeps its quotes and spacing whether or not flags were given
+func textWithoutFlags(tokens []argToken, from argToken) string {
+	var text strings.Builder
+	rest := from.rest
+	for ti, token := range tokens {
+		// every rest is a suffix of the line, so a longer rest means the flag came before the text
+		if !token.flag || len(token.rest) > len(rest) {
+			continue
+		}
+		text.WriteString(rest[:len(rest)-len(token.rest)])
+		rest = ""
+		if ti+1 < len(tokens) {
+			rest = tokens[ti+1].rest
+		}
+	}
+	text.WriteString(rest)
+	return text.String()
+}
+
+// Parse parses the raw arguments of a command according to the schema
+func (schema ArgSchema) Parse(line string) (Args, error) {
+	tokens, err := tokenizeArgs(line)
+	if err != nil {
+		return nil, err
+	}
+
+	result := Args{}
+	var positional []argToken
+	for ti := range tokens {
+		token := &tokens[ti]
+		if !token.quoted && strings.HasPrefix(token.text, "--") {
+			name := strings.TrimPrefix(token.text, "--")
+			for _, spec := range schema {
+				if spec.Type == ARG_FLAG && spec.Name == name {
+					result[name] = true
+					token.flag = true
+					break
+				}
+			}
+			if token.flag {
+				continue
+			}
+		}
+		positional = append(positional, *token)
+	}
+
+	ti := 0
+	for _, spec := range schema {
+		if spec.Type == ARG_FLAG {
+			if !result.Has(spec.Name) {
+				result[spec.Name] = false
+			}
+			continue
+		}
+		if ti >= len(positional) {
+			if !spec.Optional {
+				return nil, fmt.Errorf("%s is missing", spec.Name)
+			}
+			continue
+		}
+		token := positional[ti]
+		if spec.Type == ARG_TEXT {
+			token.rest = textWithoutFlags(tokens, token)
+			ti = len(positional)
+		} else {
+			ti++
+		}
+		value, err := spec.parse(token)
+		if err != nil {
+			return nil, err
+		}
+		result[spec.Name] = value
+	}
+	if ti < len(positional) {
+		return nil, fmt.Errorf("too many arguments were given")
+	}
+	return result, nil
+}
+
+// ArgsHandler is a CommandHandler that receives its arguments already parsed
+type ArgsHandler func(ctx context.Context, client Bot, msg ReducedMessage, command Command, args Args) error
+
+// WithArgs creates a CommandHandler that parses the command's arguments using the schema,
+// replying with the error and generated usage when they are invalid.
+func WithArgs(schema ArgSchema, handler ArgsHandler) CommandHandler {
+	return func(ctx context.Context, client Bot, msg ReducedMessage, command Command) error {
+		args, err := schema.Parse(command.Args)
+		if err != nil {
+			return client.Say(msg.Channel, fmt.Sprintf("@%s %v, usage: %s", msg.User.DisplayName, err, command.Prefix+schema.Usage(command.Command)))
+		}
+		return handler(ctx, client, msg, command, args)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestArgSchemaParse(t *testing.T) {
+	title := ArgSchema{
+		{Name: "text", Type: ARG_TEXT},
+		{Name: "x", Type: ARG_FLAG},
+	}
+	put := ArgSchema{
+		{Name: "message", Type: ARG_STRING, MinLen: 3, MaxLen: 10},
+		{Name: "pastebin", Optional: true},
+	}
+	mixed := ArgSchema{
+		{Name: "user", Type: ARG_USER},
+		{Name: "count", Type: ARG_INT},
+		{Name: "every", Type: ARG_DURATION, Optional: true},
+		{Name: "mode", Optional: true, Choices: []string{"add", "remove"}},
+	}
+	bounded := ArgSchema{
+		{Name: "text", Type: ARG_TEXT, MinLen: 2, MaxLen: 5},
+	}
+	minimum := ArgSchema{
+		{Name: "message", Type: ARG_STRING, MinLen: 3},
+	}
+
+	tests := []struct {
+		name   string
+		schema ArgSchema
+		line   string
+		want   Args
+		err    string
+	}{
+		{"text", title, `hello "a b"   world`, Args{"text": `hello "a b"   world`, "x": false}, ""},
+		{"text with flag", title, `hello "a b" --x world`, Args{"text": `hello "a b" world`, "x": true}, ""},
+		{"text with leading flag", title, `--x hello  "a b"`, Args{"text": `hello  "a b"`, "x": true}, ""},
+		{"text with trailing flag", title, `hello "a b" --x`, Args{"text": `hello "a b"`, "x": true}, ""},
+		{"unknown flag is text", title, `hello --y`, Args{"text": `hello --y`, "x": false}, ""},
+		{"quoted flag is text", title, `"--x" hello`, Args{"text": `"--x" hello`, "x": false}, ""},
+		{"quoted string", put, `"my code" https://pastebin.com/x`, Args{"message": "my code", "pastebin": "https://pastebin.com/x"}, ""},
+		{"unquoted string", put, `code`, Args{"message": "code"}, ""},
+		{"missing quote", put, `"my code`, nil, "a quote is missing its closing \""},
+		{"string too short", put, `"ab"`, nil, "message must be between 3 and 10 characters"},
+		{"string too long", put, `"abcdefghijk"`, nil, "message must be between 3 and 10 characters"},
+		{"string length in characters", put, `"ééééééééé"`, Args{"message": "ééééééééé"}, ""},
+		{"text too short", bounded, `a`, nil, "text must be between 2 and 5 characters"},
+		{"text too long", bounded, `a b c d`, nil, "text must be between 2 and 5 characters"},
+		{"string under the minimum", minimum, `ab`, nil, "message must be at least 3 characters"},
+		{"string without a maximum", minimum, `"a very long message"`, Args{"message": "a very long message"}, ""},
+		{"missing argument", put, ``, nil, "message is missing"},
+		{"too many arguments", put, `one two three`, nil, "too many arguments were given"},
+		{"typed arguments", mixed, `@someone 3 5m ADD`, Args{"user": "someone", "count": 3, "every": 5 * time.Minute, "mode": "add"}, ""},
+		{"user without @", mixed, `someone 3`, Args{"user": "someone", "count": 3}, ""},
+		{"not a number", mixed, `someone three`, nil, "\"three\" is not a number for count"},
+		{"not a duration", mixed, `someone 3 soon`, nil, "\"soon\" is not a duration (like 5m or 1h30m) for every"},
+		{"not a choice", mixed, `someone 3 5m swap`, nil, "mode must be one of add, remove"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			args, err := test.schema.Parse(test.line)
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("Parse(%q) error = %v, want %q", test.line, err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", test.line, err)
+			}
+			if !reflect.DeepEqual(args, test.want) {
+				t.Errorf("Parse(%q) = %#v, want %#v", test.line, args, test.want)
+			}
+		})
+	}
+}
+
+func TestArgSchemaUsage(t *testing.T) {
+	schema := ArgSchema{
+		{Name: "message", Type: ARG_STRING, MinLen: 20, MaxLen: 120},
+		{Name: "user", Type: ARG_USER, Optional: true},
+		{Name: "mode", Choices: []string{"add", "remove"}},
+		{Name: "count", Type: ARG_INT},
+		{Name: "quiet", Type: ARG_FLAG},
+		{Name: "reason", Type: ARG_TEXT, MinLen: 5},
+	}
+	want := `help "message" (20-120 chars) [@user] <add|remove> <count:number> [--quiet] <reason> (5+ chars)`
+	if got := schema.Usage("help"); got != want {
+		t.Errorf("Usage = %q, want %q", got, want)
+	}
+}
@@ -1,134 +1,459 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/aaron-jencks/gitchbot/helix"
 	"github.com/aaron-jencks/gitchbot/storage"
 
 	twitch "github.com/gempir/go-twitch-irc/v4"
 )
 
+// ALL_CHANNELS can be used in place of a channel name when registering handlers
+// that should respond in every channel the bot has joined.
+const ALL_CHANNELS = ""
+
 type Bot interface {
-	Channel() string
+	Channels() []string
 	Join(channel string) error
 	Depart(channel string) error
-	Say(message string) error
+	Say(channel, message string) error
+	Post(channel, message string, priority Priority) error
 	Whisper(user, message string) error
-	Storage() storage.StorageBacking
-	RegisterHandler(name string, handler CommandHandler)
-	HandlerExists(name string) bool
-	UnregisterHandler(name string)
-	Loop()
+	Storage(channel string) storage.StorageBacking
+	Prefixes(channel string) []string
+	SetPrefixes(channel string, prefixes ...string)
+	RegisterHandler(channel string, info HandlerInfo, handler CommandHandler)
+	ListHandlers(channel string) []HandlerInfo
+	DescribeHandler(channel, name string) (HandlerInfo, bool)
+	Use(middlewares ...Middleware)
+	HandlerExists(channel, name string) bool
+	UnregisterHandler(channel, name string)
+	RegisterAlias(channel, alias, target string)
+	UnregisterAlias(channel, alias string)
+	SetCooldown(channel, name string, cooldown storage.Cooldown) error
+	Loop() error
+	Flush(ctx context.Context) error
+	Stop() error
+	ConnectionState() ConnectionState
+	OnConnectionStateChange(listener ConnectionListener)
+	OnStop(listener StopListener)
+	Events() *EventBus
+	Submit(job func()) bool
+	Helix() *helix.Client
 }
 
+// StopListener is called while the bot is stopping, once no more handlers are running
+// but before the storage for each channel is closed.
+type StopListener func(client Bot)
+
+// StorageFactory opens the storage backing for a single channel,
+// it is called once per channel when the channel is joined.
+type StorageFactory func(channel string) (storage.StorageBacking, error)
+
 type BasicTwitchBot struct {
-	username string
-	channel  string
-	client   *twitch.Client
-	handlers map[string]CommandHandler
-	storage  storage.StorageBacking
+	username    string
+	client      *twitch.Client
+	registry    *handlerRegistry
+	storageLock sync.RWMutex
+	storage     map[string]storage.StorageBacking
+	openStorage StorageFactory
+	cooldowns   *cooldownTracker
+	outbox      *outbox
+	dispatcher  *dispatcher
+	ctx         context.Context
+	cancel      context.CancelFunc
+	background  sync.WaitGroup
+	connection  connectionMonitor
+	suggestions *suggestionLimiter
+	events      *EventBus
+	stopLock    sync.Mutex
+	onStop      []StopListener
+	api         *helix.Client
+	userLock    sync.RWMutex
+	userID      string
 }
 
-func CreateBasicTwitchBot(username, oauth string, backer storage.StorageBacking) *BasicTwitchBot {
+func CreateBasicTwitchBot(username, oauth string, backer StorageFactory) *BasicTwitchBot {
+	client := twitch.NewClient(username, oauth)
+	client.Capabilities = append(client.Capabilities, twitch.MembershipCapability)
+	ctx, cancel := context.WithCancel(context.Background())
 	result := BasicTwitchBot{
-		username: username,
-		client:   twitch.NewClient(username, oauth),
-		handlers: map[string]CommandHandler{},
-		storage:  backer,
+		username:    username,
+		client:      client,
+		registry:    createHandlerRegistry(),
+		storage:     map[string]storage.StorageBacking{},
+		openStorage: backer,
+		cooldowns:   createCooldownTracker(),
+		suggestions: createSuggestionLimiter(),
+		events:      CreateEventBus(),
+		outbox:      createOutbox(client.Say),
+		dispatcher:  createDispatcher(DEFAULT_DISPATCH_WORKERS, DEFAULT_HANDLER_TIMEOUT),
+		ctx:         ctx,
+		cancel:      cancel,
 	}
+	result.Use(LoggingMiddleware)
 	return &result
 }
 
-func (bb *BasicTwitchBot) Channel() string {
-	return bb.channel
+// Events is the bus that every message received from twitch is published to
+func (bb *BasicTwitchBot) Events() *EventBus {
+	return bb.events
+}
+
+// Submit runs the job on the workers that handle commands, so that event subscribers can do slow work
+// without blocking reading from the irc connection. The job is dropped if the workers are too busy.
+func (bb *BasicTwitchBot) Submit(job func()) bool {
+	return bb.dispatcher.submit(job)
+}
+
+// SetHelixClient sets the client used for the parts of twitch that are not available over irc, such as whispers
+func (bb *BasicTwitchBot) SetHelixClient(client *helix.Client) {
+	bb.userLock.Lock()
+	defer bb.userLock.Unlock()
+	bb.api = client
+	bb.userID = ""
+}
+
+// Helix is the client for the helix api, it is nil when none has been set
+func (bb *BasicTwitchBot) Helix() *helix.Client {
+	bb.userLock.RLock()
+	defer bb.userLock.RUnlock()
+	return bb.api
+}
+
+// ownUserID looks up the bot's own user id the first time it is needed
+func (bb *BasicTwitchBot) ownUserID(ctx context.Context) (*helix.Client, string, error) {
+	bb.userLock.RLock()
+	api, userID := bb.api, bb.userID
+	bb.userLock.RUnlock()
+	if api == nil {
+		return nil, "", fmt.Errorf("no helix client has been set")
+	}
+	if userID != "" {
+		return api, userID, nil
+	}
+
+	// the lookup is made without holding the lock so that it does not block other uses of the client
+	user, err := api.GetUser(ctx, bb.username)
+	if err != nil {
+		return nil, "", err
+	}
+	bb.userLock.Lock()
+	defer bb.userLock.Unlock()
+	// the client may have been replaced while the lookup was made
+	if bb.api == api && bb.userID == "" {
+		bb.userID = user.ID
+	}
+	return api, user.ID, nil
+}
+
+// SetSuggestions enables replying to unknown commands with the closest known command
+func (bb *BasicTwitchBot) SetSuggestions(enabled bool) {
+	bb.suggestions.setEnabled(enabled)
+}
+
+// SetDispatchLimits configures how many commands are handled concurrently and how long
+// a single handler may take, it must be called before Loop.
+func (bb *BasicTwitchBot) SetDispatchLimits(workers int, timeout time.Duration) {
+	bb.dispatcher = createDispatcher(workers, timeout)
+}
+
+func normalizeChannel(channel string) string {
+	return strings.ToLower(strings.TrimPrefix(channel, "#"))
+}
+
+func (bb *BasicTwitchBot) Channels() []string {
+	bb.storageLock.RLock()
+	defer bb.storageLock.RUnlock()
+	result := make([]string, 0, len(bb.storage))
+	for channel := range bb.storage {
+		result = append(result, channel)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func (bb *BasicTwitchBot) Storage(channel string) storage.StorageBacking {
+	bb.storageLock.RLock()
+	defer bb.storageLock.RUnlock()
+	return bb.storage[normalizeChannel(channel)]
+}
+
+func (bb *BasicTwitchBot) HandlerExists(channel, name string) bool {
+	return bb.registry.exists(normalizeChannel(channel), name)
+}
+
+// Prefixes returns the prefixes commands can start with in the channel, the first is the primary prefix
+func (bb *BasicTwitchBot) Prefixes(channel string) []string {
+	return bb.registry.getPrefixes(normalizeChannel(channel))
+}
+
+// SetPrefixes changes the prefixes commands can start with in the channel, ALL_CHANNELS sets the default,
+// setting no prefixes for a channel reverts it to the default
+func (bb *BasicTwitchBot) SetPrefixes(channel string, prefixes ...string) {
+	bb.registry.setPrefixes(normalizeChannel(channel), prefixes)
+}
+
+func (bb *BasicTwitchBot) RegisterHandler(channel string, info HandlerInfo, handler CommandHandler) {
+	if info.Usage == "" {
+		info.Usage = info.Name
+	}
+	bb.registry.register(normalizeChannel(channel), registeredHandler{
+		info:    info,
+		handler: handler,
+	})
+}
+
+// ListHandlers lists the commands available in the channel, including those registered for all channels
+func (bb *BasicTwitchBot) ListHandlers(channel string) []HandlerInfo {
+	return bb.registry.list(normalizeChannel(channel))
+}
+
+// DescribeHandler finds the info of a command, or the command an alias refers to
+func (bb *BasicTwitchBot) DescribeHandler(channel, name string) (HandlerInfo, bool) {
+	channel = normalizeChannel(channel)
+	handler, ok := bb.registry.find(channel, bb.registry.resolveAlias(channel, name))
+	return handler.info, ok
 }
 
-func (bb *BasicTwitchBot) Storage() storage.StorageBacking {
-	return bb.storage
+// Use adds middlewares that wrap every command handler, in every channel
+func (bb *BasicTwitchBot) Use(middlewares ...Middleware) {
+	bb.registry.use(middlewares...)
 }
 
-func (bb *BasicTwitchBot) HandlerExists(name string) bool {
-	_, ok := bb.handlers[name]
-	return ok
+func (bb *BasicTwitchBot) UnregisterHandler(channel, name string) {
+	bb.registry.unregister(normalizeChannel(channel), name)
 }
 
-func (bb *BasicTwitchBot) RegisterHandler(name string, handler CommandHandler) {
-	bb.handlers[name] = handler
+func (bb *BasicTwitchBot) RegisterAlias(channel, alias, target string) {
+	bb.registry.registerAlias(normalizeChannel(channel), alias, target)
 }
 
-func (bb *BasicTwitchBot) UnregisterHandler(name string) {
-	delete(bb.handlers, name)
+func (bb *BasicTwitchBot) UnregisterAlias(channel, alias string) {
+	bb.registry.unregisterAlias(normalizeChannel(channel), alias)
+}
+
+// SetCooldown configures and persists the cooldown of a command in a channel
+func (bb *BasicTwitchBot) SetCooldown(channel, name string, cooldown storage.Cooldown) error {
+	channel = normalizeChannel(channel)
+	backer := bb.Storage(channel)
+	if backer == nil {
+		return fmt.Errorf("cannot set cooldown in %s, channel has not been joined", channel)
+	}
+	err := backer.SetCooldown(name, cooldown)
+	if err != nil {
+		return err
+	}
+	bb.cooldowns.set(channel, name, cooldown)
+	return nil
 }
 
 func (bb *BasicTwitchBot) Join(channel string) error {
+	channel = normalizeChannel(channel)
+	if channel == ALL_CHANNELS {
+		return fmt.Errorf("cannot join a channel without a name")
+	}
+	bb.storageLock.Lock()
+	defer bb.storageLock.Unlock()
+	if _, ok := bb.storage[channel]; !ok {
+		backer, err := bb.openStorage(channel)
+		if err != nil {
+			return fmt.Errorf("failed to open storage for channel %s: %v", channel, err)
+		}
+		err = bb.cooldowns.load(channel, backer)
+		if err != nil {
+			return fmt.Errorf("failed to load cooldowns for channel %s: %v", channel, err)
+		}
+		bb.storage[channel] = backer
+	}
 	bb.client.Join(channel)
-	bb.channel = channel
 	return nil
 }
 
+// Depart leaves the channel and closes its storage
 func (bb *BasicTwitchBot) Depart(channel string) error {
+	channel = normalizeChannel(channel)
 	bb.client.Depart(channel)
-	bb.channel = ""
-	return nil
+	bb.storageLock.Lock()
+	defer bb.storageLock.Unlock()
+	backer, ok := bb.storage[channel]
+	if !ok {
+		return nil
+	}
+	delete(bb.storage, channel)
+	return backer.Close()
 }
 
-func (bb *BasicTwitchBot) Say(message string) error {
-	bb.client.Say(bb.channel, message)
+// Say queues a reply in the channel, replies take priority over other queued messages
+func (bb *BasicTwitchBot) Say(channel, message string) error {
+	return bb.Post(channel, message, PRIORITY_HIGH)
+}
+
+// Post queues a message for the channel, it is sent once the rate limit allows
+func (bb *BasicTwitchBot) Post(channel, message string, priority Priority) error {
+	channel = normalizeChannel(channel)
+	if bb.Storage(channel) == nil {
+		return fmt.Errorf("cannot send message to %s, channel has not been joined", channel)
+	}
+	for _, chunk := range SplitMessage(message, MAX_MSG_LEN) {
+		bb.outbox.enqueue(channel, chunk, priority)
+	}
 	return nil
 }
 
+// Whisper sends the user a whisper through the helix api, twitch no longer delivers whispers sent over irc
 func (bb *BasicTwitchBot) Whisper(user, message string) error {
-	bb.client.Say(bb.channel, fmt.Sprintf("/w %s %s", user, message))
+	ctx := bb.ctx
+	api, fromID, err := bb.ownUserID(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot whisper %s: %w", user, err)
+	}
+	recipient, err := api.GetUser(ctx, strings.TrimPrefix(user, "@"))
+	if err != nil {
+		return fmt.Errorf("cannot whisper %s: %w", user, err)
+	}
+	for _, chunk := range SplitMessage(message, MAX_MSG_LEN) {
+		err = api.SendWhisper(ctx, fromID, recipient.ID, chunk)
+		if errors.Is(err, helix.ErrPhoneNotVerified) {
+			return fmt.Errorf("cannot whisper %s, the bot's account needs a verified phone number: %w", user, err)
+		}
+		if errors.Is(err, helix.ErrMissingScope) {
+			return fmt.Errorf("cannot whisper %s, the token needs the user:manage:whispers scope: %w", user, err)
+		}
+		if err != nil {
+			return fmt.Errorf("cannot whisper %s: %w", user, err)
+		}
+	}
 	return nil
 }
 
-func (bb *BasicTwitchBot) Loop() {
+func (bb *BasicTwitchBot) ConnectionState() ConnectionState {
+	return bb.connection.get()
+}
+
+// OnConnectionStateChange registers a listener that is called each time the bot connects,
+// disconnects or is stopped
+func (bb *BasicTwitchBot) OnConnectionStateChange(listener ConnectionListener) {
+	bb.connection.subscribe(listener)
+}
+
+// Loop connects to twitch and handles messages until the bot is stopped,
+// lost connections are retried with a backoff, only authentication failures are returned.
+func (bb *BasicTwitchBot) Loop() error {
+	bb.client.OnConnect(func() {
+		// Stop cannot disconnect a connection that is still being made, so close it here instead
+		if bb.ctx.Err() != nil {
+			bb.client.Disconnect()
+			return
+		}
+		bb.connection.set(bb, STATE_CONNECTED)
+	})
+	bb.OnConnectionStateChange(func(client Bot, state ConnectionState) {
+		bb.outbox.setPaused(state != STATE_CONNECTED)
+	})
+
+	attachEventBus(bb.client, bb, bb.events)
 	bb.client.OnPrivateMessage(func(message twitch.PrivateMessage) {
-		log.Printf("%s: %s\n", message.User.DisplayName, message.Message)
+		log.Printf("[%s] %s: %s\n", message.Channel, message.User.DisplayName, message.Message)
+		bb.events.Publish(bb, message)
 
 		if message.User.DisplayName != bb.username {
-			TimerMarkMessageReceived() // this helps avoid spam
+			TimerMarkMessageReceived(message.Channel) // this helps avoid spam
 		}
 
-		if ContainsCommand(message.Message) {
-			cmd, err := ParseCommand(message.Message)
-			if err != nil {
-				log.Printf("failed to parse command message: %v\n", err)
-				return
-			}
-			handler, ok := bb.handlers[cmd.Command]
+		cmd, err := ParseCommand(message.Message, bb.Prefixes(message.Channel), bb.username)
+		if err == nil {
+			ok := bb.dispatcher.submit(func() {
+				bb.handleCommand(bb.ctx, message, cmd)
+			})
 			if !ok {
-				log.Printf("no handler found for command \"%s\"\n", cmd.Command)
-				return
-			}
-			err = handler(bb, ReducedMessage{
-				User:    message.User,
-				Channel: message.Channel,
-				Message: message.Message,
-			}, cmd)
-			if err != nil {
-				log.Printf("failed to handle command \"%s\" with params: \"%s\": %v\n", cmd.Command, cmd.Args, err)
+				log.Printf("dropping command from %s in %s, too many commands are being handled\n", message.User.DisplayName, message.Channel)
 			}
 		}
 	})
 
+	Subscribe(bb.events, func(client Bot, message twitch.UserStateMessage) {
+		_, broad := message.User.Badges["broadcaster"]
+		_, mod := message.User.Badges["moderator"]
+		bb.outbox.setModerator(normalizeChannel(message.Channel), broad || mod)
+	})
+
+	bb.background.Add(2)
+	go func() {
+		defer bb.background.Done()
+		bb.outbox.run(bb.ctx)
+	}()
+	bb.dispatcher.start(bb.ctx, &bb.background)
+
 	go func() {
+		defer bb.background.Done()
 		timer := time.NewTicker(time.Second)
+		defer timer.Stop()
 		for {
-			<-timer.C
-			err := HandleTimers(bb)
-			if err != nil {
-				log.Printf("failed to handle timers: %v\n", err)
-				continue
+			select {
+			case <-bb.ctx.Done():
+				return
+			case <-timer.C:
+			}
+			if bb.connection.get() != STATE_CONNECTED {
+				continue // timers are paused while disconnected
+			}
+			for _, channel := range bb.Channels() {
+				err := HandleTimers(bb, channel)
+				if err != nil {
+					log.Printf("failed to handle timers for %s: %v\n", channel, err)
+				}
 			}
 		}
 	}()
 
 	log.Printf("Bot %s started...\n", bb.username)
-	err := bb.client.Connect()
-	if err != nil {
-		log.Println(err)
+	err := bb.supervise(bb.ctx)
+	bb.cancel()
+	return err
+}
+
+// Flush waits until all queued outgoing messages have been sent or the context is done
+func (bb *BasicTwitchBot) Flush(ctx context.Context) error {
+	return bb.outbox.drain(ctx)
+}
+
+// OnStop registers a listener that is called when the bot is stopped, it can still use the channels' storage
+func (bb *BasicTwitchBot) OnStop(listener StopListener) {
+	bb.stopLock.Lock()
+	defer bb.stopLock.Unlock()
+	bb.onStop = append(bb.onStop, listener)
+}
+
+// Stop stops the timers, outgoing messages and command handlers, calls the stop listeners,
+// departs every channel and disconnects from twitch, any handlers that are still running have their context cancelled.
+func (bb *BasicTwitchBot) Stop() error {
+	bb.cancel()
+	bb.background.Wait()
+	bb.stopLock.Lock()
+	listeners := bb.onStop
+	bb.onStop = nil
+	bb.stopLock.Unlock()
+	for _, listener := range listeners {
+		listener(bb)
+	}
+	for _, channel := range bb.Channels() {
+		err := bb.Depart(channel)
+		if err != nil {
+			log.Printf("failed to close storage for %s: %v\n", channel, err)
+		}
+	}
+	err := bb.client.Disconnect()
+	if errors.Is(err, twitch.ErrConnectionIsNotOpen) {
+		return nil
 	}
+	return err
 }
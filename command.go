@@ -1,6 +1,11 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
 	twitch "github.com/gempir/go-twitch-irc/v4"
 	"github.com/oriser/regroup"
 )
@@ -8,17 +13,57 @@ import (
 type Command struct {
 	Command string
 	Args    string
+	Prefix  string // the prefix the command was invoked with, used when showing usage
 }
 
-var CMD_REGEX = regroup.MustCompile(`!(?P<command>\w+)(\s+(?P<args>.+))?`)
+const DEFAULT_PREFIX = "!"
+
+// CMD_REGEX matches a command once the prefix or mention has been removed from the start of the line,
+// punctuation directly after the command is ignored so that "!discord?" still works
+var CMD_REGEX = regroup.MustCompile(`^(?P<command>\w+)(\s+(?P<args>.+))?`)
+
+// MENTION_REGEX matches a message starting with a mention, e.g. "@gitchbot discord"
+var MENTION_REGEX = regroup.MustCompile(`^@(?P<user>\w+)[,:]?\s+(?P<rest>.+)$`)
 
-func ContainsCommand(line string) bool {
-	_, err := CMD_REGEX.Groups(line)
+// ContainsCommand determines if the line starts with one of the prefixes or mentions the bot
+func ContainsCommand(line string, prefixes []string, botName string) bool {
+	_, err := ParseCommand(line, prefixes, botName)
 	return err == nil
 }
 
-func ParseCommand(line string) (cmd Command, err error) {
-	matches, err := CMD_REGEX.Groups(line)
+// ParseCommand parses a command from the start of the line, the command must directly follow
+// one of the prefixes, or the line must start by mentioning the bot, e.g. "@gitchbot discord".
+// The longest matching prefix is used, and commands invoked by mention use the first prefix when showing usage.
+func ParseCommand(line string, prefixes []string, botName string) (cmd Command, err error) {
+	line = strings.TrimSpace(line)
+	rest := ""
+	found := false
+	if matches, merr := MENTION_REGEX.Groups(line); merr == nil && botName != "" && strings.EqualFold(matches["user"], botName) {
+		rest = matches["rest"]
+		found = true
+		if len(prefixes) > 0 {
+			cmd.Prefix = prefixes[0]
+		}
+	} else {
+		// try the longest prefixes first so that "!!" is not mistaken for "!"
+		sorted := append([]string(nil), prefixes...)
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return len(sorted[i]) > len(sorted[j])
+		})
+		for _, prefix := range sorted {
+			if prefix != "" && strings.HasPrefix(line, prefix) {
+				rest = strings.TrimPrefix(line, prefix)
+				cmd.Prefix = prefix
+				found = true
+				break
+			}
+		}
+	}
+	if !found {
+		err = fmt.Errorf("line does not start with a command prefix")
+		return
+	}
+	matches, err := CMD_REGEX.Groups(rest)
 	if err != nil {
 		return
 	}
@@ -33,10 +78,66 @@ type ReducedMessage struct {
 	Message string
 }
 
+// Role describes the permission level of a chatter, roles are ordered so that
+// a chatter with a higher role may use any command requiring a lower one.
+type Role int
+
+const (
+	ROLE_EVERYONE Role = iota
+	ROLE_SUBSCRIBER
+	ROLE_VIP
+	ROLE_MODERATOR
+	ROLE_BROADCASTER
+)
+
+func (r Role) String() string {
+	switch r {
+	case ROLE_SUBSCRIBER:
+		return "subscriber"
+	case ROLE_VIP:
+		return "vip"
+	case ROLE_MODERATOR:
+		return "moderator"
+	case ROLE_BROADCASTER:
+		return "broadcaster"
+	}
+	return "everyone"
+}
+
+// Role determines the highest role of the sender from their badges
+func (rm ReducedMessage) Role() Role {
+	badges := rm.User.Badges
+	if _, ok := badges["broadcaster"]; ok {
+		return ROLE_BROADCASTER
+	}
+	if _, ok := badges["moderator"]; ok {
+		return ROLE_MODERATOR
+	}
+	if _, ok := badges["vip"]; ok {
+		return ROLE_VIP
+	}
+	if _, ok := badges["subscriber"]; ok {
+		return ROLE_SUBSCRIBER
+	}
+	if _, ok := badges["founder"]; ok {
+		return ROLE_SUBSCRIBER
+	}
+	return ROLE_EVERYONE
+}
+
+func (rm ReducedMessage) HasRole(role Role) bool {
+	return rm.Role() >= role
+}
+
 func (rm ReducedMessage) IsModerator() bool {
-	_, broad := rm.User.Badges["broadcaster"]
-	_, mod := rm.User.Badges["moderator"]
-	return broad || mod
+	return rm.HasRole(ROLE_MODERATOR)
+}
+
+// NotAllowedMessage is the reply sent when a chatter lacks the role required for a command
+func NotAllowedMessage(msg ReducedMessage, role Role) string {
+	return fmt.Sprintf("@%s you must be a %s to do that", msg.User.DisplayName, role)
 }
 
-type CommandHandler func(client Bot, msg ReducedMessage, command Command) error
+// CommandHandler handles a single invocation of a command, the context is cancelled
+// when the bot is stopped or the handler has run for too long.
+type CommandHandler func(ctx context.Context, client Bot, msg ReducedMessage, command Command) error
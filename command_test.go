@@ -0,0 +1,54 @@
+package main
+
+import "testing"
+
+func TestParseCommand(t *testing.T) {
+	single := []string{"!"}
+	several := []string{"?", "!", "!!"}
+
+	tests := []struct {
+		name     string
+		line     string
+		prefixes []string
+		want     Command
+		err      bool
+	}{
+		{"command", "!discord", single, Command{Command: "discord", Prefix: "!"}, false},
+		{"command with args", "!help put  \"my code\" ", single, Command{Command: "help", Args: "put  \"my code\"", Prefix: "!"}, false},
+		{"leading space", "   !lurk", single, Command{Command: "lurk", Prefix: "!"}, false},
+		{"text before the prefix", "I scored 10!wow", single, Command{}, true},
+		{"prefix inside a word", "wow!wow", single, Command{}, true},
+		{"no command", "!", single, Command{}, true},
+		{"space after the prefix", "! discord", single, Command{}, true},
+		{"question mark", "!discord?", single, Command{Command: "discord", Prefix: "!"}, false},
+		{"exclamation mark", "!lurk!", single, Command{Command: "lurk", Prefix: "!"}, false},
+		{"second prefix", "?discord", several, Command{Command: "discord", Prefix: "?"}, false},
+		{"longest prefix", "!!x", several, Command{Command: "x", Prefix: "!!"}, false},
+		{"shorter prefix", "!x", several, Command{Command: "x", Prefix: "!"}, false},
+		{"unknown prefix", "#discord", several, Command{}, true},
+		{"no prefixes", "!discord", nil, Command{}, true},
+		{"mention", "@gitchbot discord", several, Command{Command: "discord", Prefix: "?"}, false},
+		{"mention with case and comma", "@GitchBot, help put hi", single, Command{Command: "help", Args: "put hi", Prefix: "!"}, false},
+		{"mention with colon", "@gitchbot: lurk", single, Command{Command: "lurk", Prefix: "!"}, false},
+		{"mention of someone else", "@other discord", single, Command{}, true},
+		{"mention without command", "@gitchbot", single, Command{}, true},
+		{"mention with prefixed command", "@gitchbot !discord", single, Command{}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cmd, err := ParseCommand(test.line, test.prefixes, "gitchbot")
+			if test.err {
+				if err == nil {
+					t.Fatalf("ParseCommand(%q) = %+v, want an error", test.line, cmd)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseCommand(%q) error = %v", test.line, err)
+			}
+			if cmd != test.want {
+				t.Errorf("ParseCommand(%q) = %+v, want %+v", test.line, cmd, test.want)
+			}
+		})
+	}
+}
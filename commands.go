@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+var COMMANDS_ARGS = ArgSchema{
+	{Name: "page", Type: ARG_INT, Optional: true},
+}
+
+var USAGE_ARGS = ArgSchema{
+	{Name: "command"},
+}
+
+// pageCommandNames groups the names into pages that each fit within limit characters
+// once joined with ", "
+func pageCommandNames(names []string, limit int) [][]string {
+	var pages [][]string
+	var current []string
+	currentLen := 0
+	for _, name := range names {
+		nameLen := utf8.RuneCountInString(name)
+		if len(current) > 0 && currentLen+len(", ")+nameLen > limit {
+			pages = append(pages, current)
+			current = nil
+			currentLen = 0
+		}
+		if len(current) > 0 {
+			currentLen += len(", ")
+		}
+		current = append(current, name)
+		currentLen += nameLen
+	}
+	if len(current) > 0 {
+		pages = append(pages, current)
+	}
+	return pages
+}
+
+// CreateCommandListHandlers registers the !commands and !usage commands in every channel
+func CreateCommandListHandlers(b Bot) {
+	b.RegisterHandler(ALL_CHANNELS, HandlerInfo{
+		Name:        "commands",
+		Description: "lists the commands you can use",
+		Usage:       COMMANDS_ARGS.Usage("commands"),
+	}, WithArgs(COMMANDS_ARGS, func(ctx context.Context, client Bot, msg ReducedMessage, command Command, args Args) error {
+		var names []string
+		for _, info := range client.ListHandlers(msg.Channel) {
+			if msg.HasRole(info.Role) {
+				names = append(names, command.Prefix+info.Name)
+			}
+		}
+		header := fmt.Sprintf("@%s commands (%%d/%%d): ", msg.User.DisplayName)
+		// leave room for the page numbers in the header
+		pages := pageCommandNames(names, MAX_MSG_LEN-utf8.RuneCountInString(header)-8)
+		if len(pages) == 0 {
+			return client.Say(msg.Channel, fmt.Sprintf("@%s there are no commands available", msg.User.DisplayName))
+		}
+		page := 1
+		if args.Has("page") {
+			page = args.Int("page")
+		}
+		if page < 1 || page > len(pages) {
+			return client.Say(msg.Channel, fmt.Sprintf("@%s page must be between 1 and %d", msg.User.DisplayName, len(pages)))
+		}
+		return client.Say(msg.Channel, fmt.Sprintf(header, page, len(pages))+strings.Join(pages[page-1], ", "))
+	}))
+
+	b.RegisterHandler(ALL_CHANNELS, HandlerInfo{
+		Name:        "usage",
+		Description: "explains how to use a command",
+		Usage:       USAGE_ARGS.Usage("usage"),
+	}, WithArgs(USAGE_ARGS, func(ctx context.Context, client Bot, msg ReducedMessage, command Command, args Args) error {
+		name := args.String("command")
+		for _, prefix := range client.Prefixes(msg.Channel) {
+			name = strings.TrimPrefix(name, prefix)
+		}
+		info, ok := client.DescribeHandler(msg.Channel, name)
+		if !ok {
+			return client.Say(msg.Channel, fmt.Sprintf("@%s there is no command called %s%s", msg.User.DisplayName, command.Prefix, name))
+		}
+		reply := fmt.Sprintf("@%s %s%s", msg.User.DisplayName, command.Prefix, info.Usage)
+		if info.Description != "" {
+			reply += " - " + info.Description
+		}
+		if info.Role != ROLE_EVERYONE {
+			reply += fmt.Sprintf(" (%s only)", info.Role)
+		}
+		return client.Say(msg.Channel, reply)
+	}))
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	twitch "github.com/gempir/go-twitch-irc/v4"
+)
+
+type ConnectionState int
+
+const (
+	STATE_DISCONNECTED ConnectionState = iota
+	STATE_CONNECTING
+	STATE_CONNECTED
+	STATE_STOPPED
+)
+
+func (cs ConnectionState) String() string {
+	switch cs {
+	case STATE_CONNECTING:
+		return "connecting"
+	case STATE_CONNECTED:
+		return "connected"
+	case STATE_STOPPED:
+		return "stopped"
+	}
+	return "disconnected"
+}
+
+const (
+	RECONNECT_MIN_BACKOFF = time.Second
+	RECONNECT_MAX_BACKOFF = 5 * time.Minute
+)
+
+// ConnectionListener is called whenever the bot's connection to twitch changes state
+type ConnectionListener func(client Bot, state ConnectionState)
+
+type connectionMonitor struct {
+	lock      sync.RWMutex
+	state     ConnectionState
+	listeners []ConnectionListener
+}
+
+func (cm *connectionMonitor) get() ConnectionState {
+	cm.lock.RLock()
+	defer cm.lock.RUnlock()
+	return cm.state
+}
+
+func (cm *connectionMonitor) subscribe(listener ConnectionListener) {
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+	cm.listeners = append(cm.listeners, listener)
+}
+
+func (cm *connectionMonitor) set(client Bot, state ConnectionState) {
+	cm.lock.Lock()
+	if cm.state == state {
+		cm.lock.Unlock()
+		return
+	}
+	cm.state = state
+	listeners := make([]ConnectionListener, len(cm.listeners))
+	copy(listeners, cm.listeners)
+	cm.lock.Unlock()
+
+	log.Printf("connection is now %s\n", state)
+	for _, listener := range listeners {
+		listener(client, state)
+	}
+}
+
+// supervise keeps the bot connected to twitch, reconnecting with an exponential backoff
+// whenever the connection is lost, until the context is cancelled or authentication fails.
+// Channels are rejoined by the twitch client each time it connects.
+func (bb *BasicTwitchBot) supervise(ctx context.Context) error {
+	backoff := RECONNECT_MIN_BACKOFF
+	for {
+		bb.connection.set(bb, STATE_CONNECTING)
+		err := bb.client.Connect()
+		wasConnected := bb.connection.get() == STATE_CONNECTED
+		if ctx.Err() != nil {
+			bb.connection.set(bb, STATE_STOPPED)
+			return nil
+		}
+		bb.connection.set(bb, STATE_DISCONNECTED)
+		if errors.Is(err, twitch.ErrLoginAuthenticationFailed) {
+			return err
+		}
+
+		if wasConnected {
+			backoff = RECONNECT_MIN_BACKOFF
+		}
+		log.Printf("lost connection to twitch: %v, reconnecting in %s\n", err, backoff)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			bb.connection.set(bb, STATE_STOPPED)
+			return nil
+		case <-timer.C:
+		}
+		backoff *= 2
+		if backoff > RECONNECT_MAX_BACKOFF {
+			backoff = RECONNECT_MAX_BACKOFF
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aaron-jencks/gitchbot/storage"
+)
+
+// cooldownTracker keeps track of the configured cooldowns for each channel
+// and when each command was last used by the channel and by each user.
+type cooldownTracker struct {
+	lock      sync.Mutex
+	cooldowns map[string]map[string]storage.Cooldown
+	lastUsed  map[string]map[string]time.Time
+	userUsed  map[string]map[string]map[string]time.Time
+}
+
+func createCooldownTracker() *cooldownTracker {
+	return &cooldownTracker{
+		cooldowns: map[string]map[string]storage.Cooldown{},
+		lastUsed:  map[string]map[string]time.Time{},
+		userUsed:  map[string]map[string]map[string]time.Time{},
+	}
+}
+
+func (ct *cooldownTracker) set(channel, name string, cooldown storage.Cooldown) {
+	ct.lock.Lock()
+	defer ct.lock.Unlock()
+	channelCooldowns, ok := ct.cooldowns[channel]
+	if !ok {
+		channelCooldowns = map[string]storage.Cooldown{}
+		ct.cooldowns[channel] = channelCooldowns
+	}
+	channelCooldowns[name] = cooldown
+}
+
+func (ct *cooldownTracker) load(channel string, backer storage.StorageBacking) error {
+	cooldowns, err := backer.ListCooldowns()
+	if err != nil {
+		return err
+	}
+	for name, cooldown := range cooldowns {
+		ct.set(channel, name, cooldown)
+	}
+	return nil
+}
+
+// use checks whether the command is off cooldown for the given message,
+// if it is, the usage is recorded and true is returned.
+func (ct *cooldownTracker) use(name string, msg ReducedMessage) bool {
+	ct.lock.Lock()
+	defer ct.lock.Unlock()
+	channel := normalizeChannel(msg.Channel)
+	cooldown, ok := ct.cooldowns[channel][name]
+	if !ok {
+		return true
+	}
+	if cooldown.ModeratorExempt && msg.IsModerator() {
+		return true
+	}
+
+	now := time.Now()
+	if last, ok := ct.lastUsed[channel][name]; ok && now.Sub(last) < cooldown.Global {
+		return false
+	}
+	if last, ok := ct.userUsed[channel][name][msg.User.ID]; ok && now.Sub(last) < cooldown.User {
+		return false
+	}
+
+	if _, ok := ct.lastUsed[channel]; !ok {
+		ct.lastUsed[channel] = map[string]time.Time{}
+	}
+	ct.lastUsed[channel][name] = now
+	if _, ok := ct.userUsed[channel]; !ok {
+		ct.userUsed[channel] = map[string]map[string]time.Time{}
+	}
+	if _, ok := ct.userUsed[channel][name]; !ok {
+		ct.userUsed[channel][name] = map[string]time.Time{}
+	}
+	ct.userUsed[channel][name][msg.User.ID] = now
+	return true
+}
@@ -1,44 +1,114 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/aaron-jencks/gitchbot/storage"
 )
 
+var COUNTER_CHANGE_REGEX = regexp.MustCompile(`^([+\-=])(\d*)$`)
+
+// parseCounterChange parses a change to a counter, "+N" and "-N" add or subtract N (one when omitted)
+// and "=N" sets the counter to N.
+func parseCounterChange(change string) (operator string, amount int, err error) {
+	match := COUNTER_CHANGE_REGEX.FindStringSubmatch(change)
+	if match == nil {
+		err = fmt.Errorf("%s is not a change, use +N, -N or =N", change)
+		return
+	}
+	operator = match[1]
+	if match[2] == "" {
+		if operator == "=" {
+			err = fmt.Errorf("a value is needed to set the counter, use =N")
+			return
+		}
+		amount = 1
+		return
+	}
+	amount, err = strconv.Atoi(match[2])
+	if err != nil {
+		err = fmt.Errorf("%s is too large", match[2])
+	}
+	return
+}
+
+// generateCounterHandler creates the handler for a counter, anyone can view the counter
+// but only moderators can change it.
 func generateCounterHandler(name string) CommandHandler {
-	return func(client Bot, msg ReducedMessage, command Command) error {
-		backing := client.Storage()
+	return func(ctx context.Context, client Bot, msg ReducedMessage, command Command) error {
+		backing := client.Storage(msg.Channel)
 		current, prefix, err := backing.RetrieveCounter(name)
-		if err != nil {
-			return err
+		if errors.Is(err, storage.ErrNotFound) {
+			return client.Say(msg.Channel, fmt.Sprintf("@%s the %s counter no longer exists", msg.User.DisplayName, name))
 		}
-		current++
-		err = backing.UpdateCounter(name, current)
 		if err != nil {
 			return err
 		}
-		return client.Say(fmt.Sprintf("%s: %d\n", prefix, current))
+		change := strings.TrimSpace(command.Args)
+		if change != "" {
+			if !msg.IsModerator() {
+				return rejectCommand(client, msg, ROLE_MODERATOR)
+			}
+			operator, amount, err := parseCounterChange(change)
+			if err != nil {
+				return client.Say(msg.Channel, fmt.Sprintf("@%s %v", msg.User.DisplayName, err))
+			}
+			switch operator {
+			case "+":
+				current, err = backing.IncrementCounter(name, amount)
+			case "-":
+				current, err = backing.IncrementCounter(name, -amount)
+			default:
+				current = amount
+				err = backing.UpdateCounter(name, amount)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return client.Say(msg.Channel, fmt.Sprintf("%s: %d\n", prefix, current))
+	}
+}
+
+func counterInfo(name, prefix string) HandlerInfo {
+	return HandlerInfo{
+		Name:        name,
+		Description: fmt.Sprintf("counts %s, moderators can change it", prefix),
+		Usage:       fmt.Sprintf("%s [+N|-N|=N]", name),
 	}
 }
 
-func CreateCounterHandler(b Bot, name string, initial int, statusPrefix string) error {
-	if b.HandlerExists(name) {
-		return fmt.Errorf("failed to create counter %s, handler already exists", name)
+func CreateCounterHandler(b Bot, channel, name string, initial int, statusPrefix string) error {
+	if b.HandlerExists(channel, name) {
+		return fmt.Errorf("failed to create counter %s in %s, handler already exists", name, channel)
 	}
-	b.Storage().CreateCounter(name, initial, statusPrefix)
-	b.RegisterHandler(name, generateCounterHandler(name))
-	log.Printf("created new counter handler for %s\n", name)
+	err := b.Storage(channel).CreateCounter(name, initial, statusPrefix)
+	if err != nil && !errors.Is(err, storage.ErrAlreadyExists) {
+		return err
+	}
+	b.RegisterHandler(channel, counterInfo(name, statusPrefix), generateCounterHandler(name))
+	log.Printf("created new counter handler for %s in %s\n", name, channel)
 	return nil
 }
 
-func LoadCounterHandlers(b Bot) error {
-	counters, err := b.Storage().ListCounters()
+func LoadCounterHandlers(b Bot, channel string) error {
+	counters, err := b.Storage(channel).ListCounters()
 	if err != nil {
 		return err
 	}
 	for _, counter := range counters {
-		b.RegisterHandler(counter, generateCounterHandler(counter))
-		log.Printf("loaded counter handler for %s\n", counter)
+		_, prefix, err := b.Storage(channel).RetrieveCounter(counter)
+		if err != nil {
+			return err
+		}
+		b.RegisterHandler(channel, counterInfo(counter, prefix), generateCounterHandler(counter))
+		log.Printf("loaded counter handler for %s in %s\n", counter, channel)
 	}
 	return nil
 }
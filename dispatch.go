@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	twitch "github.com/gempir/go-twitch-irc/v4"
+)
+
+const (
+	DEFAULT_DISPATCH_WORKERS  = 4
+	DEFAULT_HANDLER_TIMEOUT   = 10 * time.Second
+	DISPATCH_QUEUE_PER_WORKER = 16
+)
+
+// ErrHandlerAbandoned is returned when a handler's context was cancelled before it finished,
+// either because it ran past its timeout or because the bot was stopped
+var ErrHandlerAbandoned = errors.New("handler did not finish")
+
+// dispatcher runs command handlers on a fixed number of workers so that slow handlers
+// do not block reading from the irc connection.
+type dispatcher struct {
+	jobs    chan func()
+	workers int
+	timeout time.Duration
+}
+
+func createDispatcher(workers int, timeout time.Duration) *dispatcher {
+	if workers < 1 {
+		workers = 1
+	}
+	return &dispatcher{
+		jobs:    make(chan func(), workers*DISPATCH_QUEUE_PER_WORKER),
+		workers: workers,
+		timeout: timeout,
+	}
+}
+
+func (d *dispatcher) start(ctx context.Context, wg *sync.WaitGroup) {
+	for wi := 0; wi < d.workers; wi++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-d.jobs:
+					job()
+				}
+			}
+		}()
+	}
+}
+
+// submit queues a job for the workers, if every worker is busy and the queue is full
+// the job is dropped rather than blocking the caller.
+func (d *dispatcher) submit(job func()) bool {
+	select {
+	case d.jobs <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+// run calls the handler on the worker with a context that is cancelled once the timeout expires.
+// Handlers are expected to give up once their context is cancelled, the worker waits for them regardless
+// so that no more than the configured number of handlers are ever running and none outlive Stop.
+func (d *dispatcher) run(ctx context.Context, handler CommandHandler, client Bot, msg ReducedMessage, cmd Command) error {
+	if d.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.timeout)
+		defer cancel()
+	}
+	err := handler(ctx, client, msg, cmd)
+	if ctx.Err() != nil {
+		return fmt.Errorf("%w: %v", ErrHandlerAbandoned, ctx.Err())
+	}
+	return err
+}
+
+func (bb *BasicTwitchBot) handleCommand(ctx context.Context, message twitch.PrivateMessage, cmd Command) {
+	channel := normalizeChannel(message.Channel)
+	cmd.Command = bb.registry.resolveAlias(channel, cmd.Command)
+	handler, ok := bb.registry.find(channel, cmd.Command)
+	rmsg := ReducedMessage{
+		User:    message.User,
+		Channel: message.Channel,
+		Message: message.Message,
+	}
+	if !ok {
+		log.Printf("no handler found for command \"%s\" in %s\n", cmd.Command, message.Channel)
+		bb.suggestCommand(rmsg, cmd)
+		return
+	}
+	// global middlewares run first, the permission and cooldown checks always run last
+	// so that a rejected command never counts towards its cooldown
+	middlewares := append(bb.registry.middlewares(), RequireRole(handler.info.Role), bb.cooldowns.middleware)
+	err := bb.dispatcher.run(ctx, Chain(handler.handler, middlewares...), bb, rmsg, cmd)
+	// handler errors are reported by the middlewares, so only report abandoned handlers here
+	if errors.Is(err, ErrHandlerAbandoned) {
+		log.Printf("command \"%s\" with params: \"%s\" was abandoned: %v\n", cmd.Command, cmd.Args, err)
+	}
+}
+
+// suggestCommand replies with the closest command the user is allowed to use, if there is one
+func (bb *BasicTwitchBot) suggestCommand(msg ReducedMessage, cmd Command) {
+	channel := normalizeChannel(msg.Channel)
+	roles := map[string]Role{}
+	var candidates []string
+	for _, info := range bb.registry.list(channel) {
+		roles[info.Name] = info.Role
+		if msg.HasRole(info.Role) {
+			candidates = append(candidates, info.Name)
+		}
+	}
+	for alias, target := range bb.registry.listAliases(channel) {
+		if role, ok := roles[target]; ok && msg.HasRole(role) {
+			candidates = append(candidates, alias)
+		}
+	}
+	suggestion, ok := closestCommand(cmd.Command, candidates)
+	if !ok || !bb.suggestions.allow(channel, msg.User.ID) {
+		return
+	}
+	err := bb.Say(msg.Channel, fmt.Sprintf("@%s did you mean %s%s?", msg.User.DisplayName, cmd.Prefix, suggestion))
+	if err != nil {
+		log.Printf("failed to suggest a command: %v\n", err)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"reflect"
+	"sync"
+
+	twitch "github.com/gempir/go-twitch-irc/v4"
+)
+
+// EventBus delivers the messages received from twitch to the features that subscribe to them.
+// Events are the message types from go-twitch-irc, such as twitch.UserNoticeMessage for subs and raids,
+// handlers are called in the order they subscribed, on the goroutine that received the message,
+// so they should not block for long.
+type EventBus struct {
+	lock        sync.RWMutex
+	subscribers map[reflect.Type][]func(client Bot, event interface{})
+}
+
+func CreateEventBus() *EventBus {
+	return &EventBus{
+		subscribers: map[reflect.Type][]func(client Bot, event interface{}){},
+	}
+}
+
+// Subscribe registers a handler for every event of type T, e.g.
+//
+//	Subscribe(bus, func(client Bot, event twitch.UserNoticeMessage) { ... })
+func Subscribe[T any](bus *EventBus, handler func(client Bot, event T)) {
+	var zero T
+	eventType := reflect.TypeOf(zero)
+	bus.lock.Lock()
+	defer bus.lock.Unlock()
+	bus.subscribers[eventType] = append(bus.subscribers[eventType], func(client Bot, event interface{}) {
+		handler(client, event.(T))
+	})
+}
+
+// Publish delivers the event to every handler subscribed to its type
+func (eb *EventBus) Publish(client Bot, event interface{}) {
+	eb.lock.RLock()
+	handlers := eb.subscribers[reflect.TypeOf(event)]
+	eb.lock.RUnlock()
+	for _, handler := range handlers {
+		handler(client, event)
+	}
+}
+
+// attachEventBus feeds every message the twitch client receives into the bus,
+// private messages are published by the bot itself since it also handles them as commands.
+func attachEventBus(client *twitch.Client, bot Bot, bus *EventBus) {
+	client.OnWhisperMessage(func(message twitch.WhisperMessage) {
+		bus.Publish(bot, message)
+	})
+	client.OnClearChatMessage(func(message twitch.ClearChatMessage) {
+		bus.Publish(bot, message)
+	})
+	client.OnClearMessage(func(message twitch.ClearMessage) {
+		bus.Publish(bot, message)
+	})
+	client.OnRoomStateMessage(func(message twitch.RoomStateMessage) {
+		bus.Publish(bot, message)
+	})
+	client.OnUserNoticeMessage(func(message twitch.UserNoticeMessage) {
+		bus.Publish(bot, message)
+	})
+	client.OnUserStateMessage(func(message twitch.UserStateMessage) {
+		bus.Publish(bot, message)
+	})
+	client.OnGlobalUserStateMessage(func(message twitch.GlobalUserStateMessage) {
+		bus.Publish(bot, message)
+	})
+	client.OnNoticeMessage(func(message twitch.NoticeMessage) {
+		bus.Publish(bot, message)
+	})
+	client.OnUserJoinMessage(func(message twitch.UserJoinMessage) {
+		bus.Publish(bot, message)
+	})
+	client.OnUserPartMessage(func(message twitch.UserPartMessage) {
+		bus.Publish(bot, message)
+	})
+	client.OnSelfJoinMessage(func(message twitch.UserJoinMessage) {
+		bus.Publish(bot, message)
+	})
+	client.OnSelfPartMessage(func(message twitch.UserPartMessage) {
+		bus.Publish(bot, message)
+	})
+	client.OnReconnectMessage(func(message twitch.ReconnectMessage) {
+		bus.Publish(bot, message)
+	})
+	client.OnNamesMessage(func(message twitch.NamesMessage) {
+		bus.Publish(bot, message)
+	})
+}
@@ -0,0 +1,44 @@
+package helix
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// Channel is the information about a broadcaster's channel, which persists between streams
+type Channel struct {
+	BroadcasterID    string `json:"broadcaster_id"`
+	BroadcasterLogin string `json:"broadcaster_login"`
+	BroadcasterName  string `json:"broadcaster_name"`
+	GameID           string `json:"game_id"`
+	GameName         string `json:"game_name"`
+	Title            string `json:"title"`
+}
+
+// ChannelUpdate holds the channel information to change, empty fields are left unchanged
+type ChannelUpdate struct {
+	GameID string `json:"game_id,omitempty"`
+	Title  string `json:"title,omitempty"`
+}
+
+// GetChannel looks up a broadcaster's channel by their user id
+func (c *Client) GetChannel(ctx context.Context, broadcasterID string) (Channel, error) {
+	var response struct {
+		Data []Channel `json:"data"`
+	}
+	err := c.do(ctx, http.MethodGet, "/channels", url.Values{"broadcaster_id": {broadcasterID}}, nil, &response)
+	if err != nil {
+		return Channel{}, err
+	}
+	if len(response.Data) == 0 {
+		return Channel{}, ErrUserNotFound
+	}
+	return response.Data[0], nil
+}
+
+// ModifyChannel changes a broadcaster's channel information,
+// the token must belong to the broadcaster or an editor and have the channel:manage:broadcast scope.
+func (c *Client) ModifyChannel(ctx context.Context, broadcasterID string, update ChannelUpdate) error {
+	return c.do(ctx, http.MethodPatch, "/channels", url.Values{"broadcaster_id": {broadcasterID}}, update, nil)
+}
@@ -0,0 +1,129 @@
+package helix
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DEFAULT_BASE_URL = "https://api.twitch.tv/helix"
+
+const REQUEST_TIMEOUT = 10 * time.Second
+
+var (
+	ErrMissingScope     = errors.New("the token is missing a required scope")
+	ErrPhoneNotVerified = errors.New("the account must have a verified phone number")
+	ErrUserNotFound     = errors.New("user does not exist")
+)
+
+// Error is the error body helix responds with when a request fails
+type Error struct {
+	Status  int    `json:"status"`
+	Kind    string `json:"error"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("helix request failed with status %d", e.Status)
+	}
+	return fmt.Sprintf("helix request failed with status %d: %s", e.Status, e.Message)
+}
+
+// Unwrap recognises the failures that are caused by how the account is set up,
+// so that they can be checked for with errors.Is
+func (e *Error) Unwrap() error {
+	message := strings.ToLower(e.Message)
+	switch {
+	case strings.Contains(message, "phone"):
+		return ErrPhoneNotVerified
+	case strings.Contains(message, "scope"):
+		return ErrMissingScope
+	}
+	return nil
+}
+
+// Client makes requests to the helix api on behalf of a single user
+type Client struct {
+	baseURL   string
+	clientID  string
+	tokenLock sync.RWMutex
+	token     string
+	http      *http.Client
+}
+
+// CreateClient creates a client for the api at baseURL, the token may be given with or without its "oauth:" prefix
+func CreateClient(baseURL, clientID, token string) *Client {
+	result := &Client{
+		baseURL:  strings.TrimSuffix(baseURL, "/"),
+		clientID: clientID,
+		http:     &http.Client{Timeout: REQUEST_TIMEOUT},
+	}
+	result.SetToken(token)
+	return result
+}
+
+// SetToken replaces the token used for requests, e.g. after it has been refreshed
+func (c *Client) SetToken(token string) {
+	c.tokenLock.Lock()
+	defer c.tokenLock.Unlock()
+	c.token = strings.TrimPrefix(token, "oauth:")
+}
+
+func (c *Client) getToken() string {
+	c.tokenLock.RLock()
+	defer c.tokenLock.RUnlock()
+	return c.token
+}
+
+// do sends a request to the api, encoding body as json when it is not nil
+// and decoding the response into result when it is not nil
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	address := c.baseURL + path
+	if len(query) > 0 {
+		address += "?" + query.Encode()
+	}
+	request, err := http.NewRequestWithContext(ctx, method, address, reader)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", "Bearer "+c.getToken())
+	request.Header.Set("Client-Id", c.clientID)
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	response, err := c.http.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		failure := &Error{}
+		json.NewDecoder(response.Body).Decode(failure)
+		failure.Status = response.StatusCode
+		return failure
+	}
+	if result == nil || response.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(response.Body).Decode(result)
+}
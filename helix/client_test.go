@@ -0,0 +1,266 @@
+package helix
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// createTestClient starts a server that responds to every request with handler
+// and returns a client that uses it as the base url
+func createTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return CreateClient(server.URL+"/", "client-id", "oauth:token")
+}
+
+func respond(status int, body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}
+}
+
+func TestClientHeaders(t *testing.T) {
+	client := createTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer token" {
+			t.Errorf("Authorization = %q, want %q", got, "Bearer token")
+		}
+		if got := r.Header.Get("Client-Id"); got != "client-id" {
+			t.Errorf("Client-Id = %q, want %q", got, "client-id")
+		}
+		if r.URL.Path != "/users" {
+			t.Errorf("path = %q, want /users", r.URL.Path)
+		}
+		respond(http.StatusOK, `{"data":[{"id":"1","login":"bot","display_name":"Bot"}]}`)(w, r)
+	})
+	_, err := client.GetUser(context.Background(), "bot")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client.SetToken("refreshed")
+	if got := client.getToken(); got != "refreshed" {
+		t.Errorf("token = %q after SetToken, want %q", got, "refreshed")
+	}
+}
+
+func TestGetUser(t *testing.T) {
+	client := createTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if login := r.URL.Query().Get("login"); login != "someone" {
+			respond(http.StatusOK, `{"data":[]}`)(w, r)
+			return
+		}
+		respond(http.StatusOK, `{"data":[{"id":"42","login":"someone","display_name":"SomeOne"}]}`)(w, r)
+	})
+
+	user, err := client.GetUser(context.Background(), "someone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := User{ID: "42", Login: "someone", DisplayName: "SomeOne"}
+	if user != want {
+		t.Errorf("GetUser = %+v, want %+v", user, want)
+	}
+
+	_, err = client.GetUser(context.Background(), "nobody")
+	if !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("GetUser of a missing user = %v, want %v", err, ErrUserNotFound)
+	}
+}
+
+func TestGetChannel(t *testing.T) {
+	client := createTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if id := r.URL.Query().Get("broadcaster_id"); id != "42" {
+			respond(http.StatusOK, `{"data":[]}`)(w, r)
+			return
+		}
+		respond(http.StatusOK, `{"data":[{"broadcaster_id":"42","broadcaster_login":"someone","broadcaster_name":"SomeOne","game_id":"7","game_name":"Chess","title":"playing chess"}]}`)(w, r)
+	})
+
+	channel, err := client.GetChannel(context.Background(), "42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Channel{
+		BroadcasterID:    "42",
+		BroadcasterLogin: "someone",
+		BroadcasterName:  "SomeOne",
+		GameID:           "7",
+		GameName:         "Chess",
+		Title:            "playing chess",
+	}
+	if channel != want {
+		t.Errorf("GetChannel = %+v, want %+v", channel, want)
+	}
+
+	_, err = client.GetChannel(context.Background(), "1")
+	if !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("GetChannel of a missing channel = %v, want %v", err, ErrUserNotFound)
+	}
+}
+
+func TestGetGame(t *testing.T) {
+	client := createTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if name := r.URL.Query().Get("name"); name != "Just Chatting" {
+			respond(http.StatusOK, `{"data":[]}`)(w, r)
+			return
+		}
+		respond(http.StatusOK, `{"data":[{"id":"509658","name":"Just Chatting"}]}`)(w, r)
+	})
+
+	game, err := client.GetGame(context.Background(), "Just Chatting")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Game{ID: "509658", Name: "Just Chatting"}
+	if game != want {
+		t.Errorf("GetGame = %+v, want %+v", game, want)
+	}
+
+	_, err = client.GetGame(context.Background(), "not a game")
+	if !errors.Is(err, ErrGameNotFound) {
+		t.Errorf("GetGame of a missing game = %v, want %v", err, ErrGameNotFound)
+	}
+}
+
+func TestGetStream(t *testing.T) {
+	client := createTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if login := r.URL.Query().Get("user_login"); login != "someone" {
+			respond(http.StatusOK, `{"data":[]}`)(w, r)
+			return
+		}
+		respond(http.StatusOK, `{"data":[{"id":"9","user_id":"42","user_login":"someone","game_id":"7","game_name":"Chess","title":"playing chess","viewer_count":12,"started_at":"2024-05-01T12:00:00Z"}]}`)(w, r)
+	})
+
+	stream, err := client.GetStream(context.Background(), "someone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Stream{
+		ID:          "9",
+		UserID:      "42",
+		UserLogin:   "someone",
+		GameID:      "7",
+		GameName:    "Chess",
+		Title:       "playing chess",
+		ViewerCount: 12,
+		StartedAt:   time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+	}
+	if stream != want {
+		t.Errorf("GetStream = %+v, want %+v", stream, want)
+	}
+
+	_, err = client.GetStream(context.Background(), "offline")
+	if !errors.Is(err, ErrStreamOffline) {
+		t.Errorf("GetStream of an offline stream = %v, want %v", err, ErrStreamOffline)
+	}
+}
+
+func TestModifyChannel(t *testing.T) {
+	var update map[string]string
+	client := createTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPatch {
+			t.Errorf("method = %s, want PATCH", r.Method)
+		}
+		if id := r.URL.Query().Get("broadcaster_id"); id != "42" {
+			t.Errorf("broadcaster_id = %q, want 42", id)
+		}
+		if got := r.Header.Get("Content-Type"); got != "application/json" {
+			t.Errorf("Content-Type = %q, want application/json", got)
+		}
+		update = nil
+		err := json.NewDecoder(r.Body).Decode(&update)
+		if err != nil {
+			t.Error(err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name   string
+		update ChannelUpdate
+		want   map[string]string
+	}{
+		{"title", ChannelUpdate{Title: "new title"}, map[string]string{"title": "new title"}},
+		{"game", ChannelUpdate{GameID: "7"}, map[string]string{"game_id": "7"}},
+		{"both", ChannelUpdate{GameID: "7", Title: "new title"}, map[string]string{"game_id": "7", "title": "new title"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := client.ModifyChannel(context.Background(), "42", test.update)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(update) != len(test.want) {
+				t.Fatalf("body = %v, want %v", update, test.want)
+			}
+			for key, value := range test.want {
+				if update[key] != value {
+					t.Errorf("body = %v, want %v", update, test.want)
+				}
+			}
+		})
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   error
+	}{
+		{"missing scope", http.StatusUnauthorized, `{"error":"Unauthorized","status":401,"message":"Missing scope: user:manage:whispers"}`, ErrMissingScope},
+		{"phone", http.StatusUnauthorized, `{"error":"Unauthorized","status":401,"message":"the sender does not have a verified phone number"}`, ErrPhoneNotVerified},
+		{"other", http.StatusBadRequest, `{"error":"Bad Request","status":400,"message":"invalid to_user_id"}`, nil},
+		{"no body", http.StatusInternalServerError, ``, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := createTestClient(t, respond(test.status, test.body))
+			err := client.SendWhisper(context.Background(), "1", "2", "hello")
+
+			var failure *Error
+			if !errors.As(err, &failure) {
+				t.Fatalf("error = %v, want an *Error", err)
+			}
+			if failure.Status != test.status {
+				t.Errorf("status = %d, want %d", failure.Status, test.status)
+			}
+			if test.want != nil && !errors.Is(err, test.want) {
+				t.Errorf("error = %v, want %v", err, test.want)
+			}
+			if test.want == nil && (errors.Is(err, ErrMissingScope) || errors.Is(err, ErrPhoneNotVerified)) {
+				t.Errorf("error = %v unwrapped to an account error", err)
+			}
+		})
+	}
+}
+
+func TestSendWhisper(t *testing.T) {
+	client := createTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/whispers" {
+			t.Errorf("request = %s %s, want POST /whispers", r.Method, r.URL.Path)
+		}
+		query := r.URL.Query()
+		if query.Get("from_user_id") != "1" || query.Get("to_user_id") != "2" {
+			t.Errorf("query = %v, want from_user_id=1 and to_user_id=2", query)
+		}
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["message"] != "hello" {
+			t.Errorf("body = %v, want message hello", body)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	err := client.SendWhisper(context.Background(), "1", "2", "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
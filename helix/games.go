@@ -0,0 +1,30 @@
+package helix
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+)
+
+var ErrGameNotFound = errors.New("game does not exist")
+
+type Game struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// GetGame looks up a game or category by its exact name
+func (c *Client) GetGame(ctx context.Context, name string) (Game, error) {
+	var response struct {
+		Data []Game `json:"data"`
+	}
+	err := c.do(ctx, http.MethodGet, "/games", url.Values{"name": {name}}, nil, &response)
+	if err != nil {
+		return Game{}, err
+	}
+	if len(response.Data) == 0 {
+		return Game{}, ErrGameNotFound
+	}
+	return response.Data[0], nil
+}
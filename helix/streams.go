@@ -0,0 +1,38 @@
+package helix
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+var ErrStreamOffline = errors.New("stream is offline")
+
+type Stream struct {
+	ID          string    `json:"id"`
+	UserID      string    `json:"user_id"`
+	UserLogin   string    `json:"user_login"`
+	GameID      string    `json:"game_id"`
+	GameName    string    `json:"game_name"`
+	Title       string    `json:"title"`
+	ViewerCount int       `json:"viewer_count"`
+	StartedAt   time.Time `json:"started_at"`
+}
+
+// GetStream looks up the live stream of a broadcaster by their login name,
+// ErrStreamOffline is returned when they are not live
+func (c *Client) GetStream(ctx context.Context, login string) (Stream, error) {
+	var response struct {
+		Data []Stream `json:"data"`
+	}
+	err := c.do(ctx, http.MethodGet, "/streams", url.Values{"user_login": {login}}, nil, &response)
+	if err != nil {
+		return Stream{}, err
+	}
+	if len(response.Data) == 0 {
+		return Stream{}, ErrStreamOffline
+	}
+	return response.Data[0], nil
+}
@@ -0,0 +1,28 @@
+package helix
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+type User struct {
+	ID          string `json:"id"`
+	Login       string `json:"login"`
+	DisplayName string `json:"display_name"`
+}
+
+// GetUser looks up a user by their login name
+func (c *Client) GetUser(ctx context.Context, login string) (User, error) {
+	var response struct {
+		Data []User `json:"data"`
+	}
+	err := c.do(ctx, http.MethodGet, "/users", url.Values{"login": {login}}, nil, &response)
+	if err != nil {
+		return User{}, err
+	}
+	if len(response.Data) == 0 {
+		return User{}, ErrUserNotFound
+	}
+	return response.Data[0], nil
+}
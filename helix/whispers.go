@@ -0,0 +1,20 @@
+package helix
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// SendWhisper whispers the message from one user to another,
+// the sender must have a verified phone number and the token the user:manage:whispers scope.
+func (c *Client) SendWhisper(ctx context.Context, fromID, toID, message string) error {
+	query := url.Values{
+		"from_user_id": {fromID},
+		"to_user_id":   {toID},
+	}
+	body := map[string]string{
+		"message": message,
+	}
+	return c.do(ctx, http.MethodPost, "/whispers", query, body, nil)
+}
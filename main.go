@@ -1,40 +1,102 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
+	"log"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/aaron-jencks/gitchbot/helix"
 	"github.com/aaron-jencks/gitchbot/storage"
-	"github.com/oriser/regroup"
 )
 
-const MAX_MSG_LEN = 512
-
-// Regex for parsing user commands, from already parsed PRIVMSG strings.
-//
-// First matched group is the command name and the second matched group is the argument for the
-// command.
-var CmdRegex *regroup.ReGroup = regroup.MustCompile(`^!(\w+)\s?(\w+)?`)
+// twitch rejects chat messages longer than 500 characters,
+// longer messages are split into multiple messages before being sent.
+const MAX_MSG_LEN = 500
 
 type Credentials struct {
 	Username string `json:"username"`
 	Token    string `json:"oauth_token"`
+	ClientID string `json:"client_id"`
 }
 
 var (
-	irc_addr    string = "irc.chat.twitch.tv:6667"
-	credentials string = "./config.json"
-	channel     string = "cheezitthehedgehog"
-	backing     string = "./data.db"
+	irc_addr    string        = "irc.chat.twitch.tv:6667"
+	helix_addr  string        = helix.DEFAULT_BASE_URL
+	credentials string        = "./config.json"
+	channels    string        = "cheezitthehedgehog"
+	backing     string        = "./data.db"
+	workers     int           = DEFAULT_DISPATCH_WORKERS
+	timeout     time.Duration = DEFAULT_HANDLER_TIMEOUT
+	goodbye     string        = ""
+	shutdown    time.Duration = 10 * time.Second
+	prefixes    string        = DEFAULT_PREFIX
+	suggest     bool          = false
 )
 
+// channelList returns the channels given with the -channel flag
+func channelList() []string {
+	var result []string
+	for _, channel := range strings.Split(channels, ",") {
+		channel = strings.TrimSpace(channel)
+		if channel != "" {
+			result = append(result, channel)
+		}
+	}
+	return result
+}
+
+// channelBackingPath determines where the database for a channel is stored, either by replacing "{channel}" in the path,
+// by using the path unchanged when only one channel is joined (so existing databases keep working),
+// or by appending the channel name to the file name.
+func channelBackingPath(path, channel string, channelCount int) string {
+	if strings.Contains(path, "{channel}") {
+		return strings.ReplaceAll(path, "{channel}", channel)
+	}
+	if channelCount <= 1 {
+		return path
+	}
+	ext := filepath.Ext(path)
+	result := strings.TrimSuffix(path, ext) + "_" + channel + ext
+	if _, err := os.Stat(result); errors.Is(err, os.ErrNotExist) {
+		if _, err := os.Stat(path); err == nil {
+			log.Printf("warning: %s does not exist yet but %s does, its data is not used for %s while joining several channels, rename it to %s to keep it\n", result, path, channel, result)
+		}
+	}
+	return result
+}
+
+// isMemoryBacking reports whether the -db flag asks for storage that is thrown away when the bot stops
+func isMemoryBacking(path string) bool {
+	return path == ":memory:" || strings.HasPrefix(path, "mem://")
+}
+
+func openChannelStorage(channel string) (storage.StorageBacking, error) {
+	if isMemoryBacking(backing) {
+		return storage.CreateMemoryBacker(), nil
+	}
+	return storage.CreateSqliteBacker(channelBackingPath(backing, channel, len(channelList())))
+}
+
 func main() {
 	flag.StringVar(&irc_addr, "address", irc_addr, "the address to use for twitch connection")
+	flag.StringVar(&helix_addr, "helix-address", helix_addr, "the base url of the twitch helix api")
 	flag.StringVar(&credentials, "credentials", credentials, "the location of the credentials json file")
-	flag.StringVar(&channel, "channel", channel, "the channel for the bot to join")
-	flag.StringVar(&backing, "db", backing, "the location of the sql database for data backing")
+	flag.StringVar(&channels, "channel", channels, "a comma separated list of channels for the bot to join")
+	flag.StringVar(&backing, "db", backing, "the location of the sql database for data backing, when joining several channels each gets its own database named after it, \"{channel}\" is replaced with the channel name, \":memory:\" or \"mem://\" keeps everything in memory instead")
+	flag.IntVar(&workers, "workers", workers, "the number of commands that can be handled concurrently")
+	flag.DurationVar(&timeout, "handler-timeout", timeout, "how long a single command handler may run before its context is cancelled")
+	flag.StringVar(&goodbye, "goodbye", goodbye, "a message to post in every channel when the bot shuts down")
+	flag.DurationVar(&shutdown, "shutdown-timeout", shutdown, "how long to wait for queued messages to be sent when shutting down")
+	flag.StringVar(&prefixes, "prefix", prefixes, "a comma separated list of prefixes that commands can start with")
+	flag.BoolVar(&suggest, "suggest", suggest, "reply to unknown commands with the closest known command")
 	flag.Parse()
 
 	fp, err := os.Open(credentials)
@@ -50,28 +112,79 @@ func main() {
 		panic(err)
 	}
 
-	sqlBacking, err := storage.CreateSqliteBacker(backing)
-	if err != nil {
-		panic(err)
+	bot := CreateBasicTwitchBot(account.Username, account.Token, openChannelStorage)
+	bot.SetDispatchLimits(workers, timeout)
+	bot.SetPrefixes(ALL_CHANNELS, strings.Split(prefixes, ",")...)
+	bot.SetSuggestions(suggest)
+	bot.SetHelixClient(helix.CreateClient(helix_addr, account.ClientID, account.Token))
+	CreateCommandListHandlers(bot)
+	CreateAlertHandlers(bot)
+	CreateStreamHandlers(bot)
+	for _, channel := range channelList() {
+		err = bot.Join(channel)
+		if err != nil {
+			panic(err)
+		}
+		err = LoadCounterHandlers(bot, channel)
+		if err != nil {
+			panic(err)
+		}
+		err = LoadMappingHandlers(bot, channel)
+		if err != nil {
+			panic(err)
+		}
+		err = LoadAliases(bot, channel)
+		if err != nil {
+			panic(err)
+		}
+
+		CreateMappingHandler(bot, channel, "discord", "I have a discord where you can ask questions any time! https://discord.gg/8M5bvJWa4b")
+		CreateMappingHandler(bot, channel, "lurk", "@{user} disappears into the shadows, they will return...")
+		CreateTimer(bot, channel, "discord", "Oh hey, there's a discord: https://discord.gg/8M5bvJWa4b", 15*time.Minute)
+		CreateTimer(bot, channel, "lurkers", "Wanna say thank you to all my lurkers, love you <3", 20*time.Minute)
+		CreateProgrammingHelpQueue(bot, channel)
+		CreateAlias(bot, channel, "dc", "discord")
+		CreateAlias(bot, channel, "q", "help")
+		CreateAlert(bot, channel, ALERT_SUB, "Thank you for subscribing @{user}! <3", 0)
+		CreateAlert(bot, channel, ALERT_RESUB, "Thank you for {months} months of support @{user}! <3", 0)
+		CreateAlert(bot, channel, ALERT_GIFT, "Thank you @{user} for gifting {count} subs! <3", 1)
+		CreateAlert(bot, channel, ALERT_RAID, "Thank you @{user} for the raid with {viewers} viewers, welcome raiders!", 1)
+		CreateAlert(bot, channel, ALERT_CHEER, "Thank you @{user} for the {bits} bits! <3", 100)
+		bot.SetCooldown(channel, "lurk", storage.Cooldown{User: 5 * time.Minute, ModeratorExempt: true})
+		bot.SetCooldown(channel, "discord", storage.Cooldown{Global: 30 * time.Second, ModeratorExempt: true})
+
+		bot.Say(channel, "Beep Boop, bot is online!")
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	loopErr := make(chan error, 1)
+	go func() {
+		loopErr <- bot.Loop()
+	}()
+
+	select {
+	case err = <-loopErr:
+		// stop the bot even when the connection failed, so that the help queues are saved again
+		stopErr := bot.Stop()
+		if stopErr != nil {
+			log.Printf("failed to stop the bot: %v\n", stopErr)
+		}
+		if err != nil {
+			panic(err)
+		}
+		return
+	case <-ctx.Done():
 	}
+	// restore the default signal handling so that a second signal kills the bot if shutting down hangs
+	stop()
 
-	bot := CreateBasicTwitchBot(account.Username, account.Token, sqlBacking)
-	err = LoadCounterHandlers(bot)
+	err = Shutdown(bot, goodbye, shutdown)
 	if err != nil {
-		panic(err)
+		log.Printf("failed to shut down cleanly: %v\n", err)
 	}
-	err = LoadMappingHandlers(bot)
+	err = <-loopErr
 	if err != nil {
-		panic(err)
+		log.Println(err)
 	}
-
-	CreateMappingHandler(bot, "discord", "I have a discord where you can ask questions any time! https://discord.gg/8M5bvJWa4b")
-	CreateMappingHandler(bot, "lurk", "@{user} disappears into the shadows, they will return...")
-	CreateTimer(bot, "discord", "Oh hey, there's a discord: https://discord.gg/8M5bvJWa4b", 15*time.Minute)
-	CreateTimer(bot, "lurkers", "Wanna say thank you to all my lurkers, love you <3", 20*time.Minute)
-	CreateProgrammingHelpQueue(bot)
-
-	bot.Join(channel)
-	bot.Say("Beep Boop, bot is online!")
-	bot.Loop()
 }
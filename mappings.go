@@ -1,41 +1,58 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
+
+	"github.com/aaron-jencks/gitchbot/storage"
 )
 
 func generateMappingHandler(name string) CommandHandler {
-	return func(client Bot, msg ReducedMessage, command Command) error {
-		backing := client.Storage()
+	return func(ctx context.Context, client Bot, msg ReducedMessage, command Command) error {
+		backing := client.Storage(msg.Channel)
 		mout, err := backing.RetrieveMapping(name)
+		if errors.Is(err, storage.ErrNotFound) {
+			return client.Say(msg.Channel, fmt.Sprintf("@%s the %s command no longer exists", msg.User.DisplayName, name))
+		}
 		if err != nil {
 			return err
 		}
 		mout = strings.ReplaceAll(mout, "{user}", msg.User.DisplayName)
-		return client.Say(mout)
+		return client.Say(msg.Channel, mout)
 	}
 }
 
-func CreateMappingHandler(b Bot, name, message string) error {
-	if b.HandlerExists(name) {
-		return fmt.Errorf("failed to create mapping for %s, handler already exists", name)
+func mappingInfo(name string) HandlerInfo {
+	return HandlerInfo{
+		Name:        name,
+		Description: fmt.Sprintf("posts the %s message", name),
+	}
+}
+
+func CreateMappingHandler(b Bot, channel, name, message string) error {
+	if b.HandlerExists(channel, name) {
+		return fmt.Errorf("failed to create mapping for %s in %s, handler already exists", name, channel)
+	}
+	err := b.Storage(channel).CreateMapping(name, message)
+	if err != nil && !errors.Is(err, storage.ErrAlreadyExists) {
+		return err
 	}
-	b.Storage().CreateMapping(name, message)
-	b.RegisterHandler(name, generateMappingHandler(name))
-	log.Printf("created new mapping handler for %s\n", name)
+	b.RegisterHandler(channel, mappingInfo(name), generateMappingHandler(name))
+	log.Printf("created new mapping handler for %s in %s\n", name, channel)
 	return nil
 }
 
-func LoadMappingHandlers(b Bot) error {
-	mappings, err := b.Storage().ListMappings()
+func LoadMappingHandlers(b Bot, channel string) error {
+	mappings, err := b.Storage(channel).ListMappings()
 	if err != nil {
 		return err
 	}
 	for name := range mappings {
-		b.RegisterHandler(name, generateMappingHandler(name))
-		log.Printf("loaded mapping handler for %s\n", name)
+		b.RegisterHandler(channel, mappingInfo(name), generateMappingHandler(name))
+		log.Printf("loaded mapping handler for %s in %s\n", name, channel)
 	}
 	return nil
 }
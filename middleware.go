@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// ErrNotAllowed is returned by handlers that rejected a command because the chatter lacks the required role
+var ErrNotAllowed = errors.New("not allowed")
+
+// ErrOnCooldown is returned when a command was ignored because it is still on cooldown
+var ErrOnCooldown = errors.New("on cooldown")
+
+// Middleware wraps a CommandHandler to add behaviour around it, such as logging or permission checks
+type Middleware func(next CommandHandler) CommandHandler
+
+// Chain wraps the handler in the given middlewares, the first middleware is the outermost
+// and so runs first.
+func Chain(handler CommandHandler, middlewares ...Middleware) CommandHandler {
+	for mi := len(middlewares) - 1; mi >= 0; mi-- {
+		handler = middlewares[mi](handler)
+	}
+	return handler
+}
+
+// LoggingMiddleware logs each command that is handled, how long it took and any error it returned,
+// commands that were rejected or are on cooldown are logged as such rather than as handled
+func LoggingMiddleware(next CommandHandler) CommandHandler {
+	return func(ctx context.Context, client Bot, msg ReducedMessage, command Command) error {
+		start := time.Now()
+		err := next(ctx, client, msg, command)
+		switch {
+		case errors.Is(err, ErrNotAllowed):
+			log.Printf("rejected command \"%s\" from %s in %s: %v\n", command.Command, msg.User.DisplayName, msg.Channel, err)
+			return err
+		case errors.Is(err, ErrOnCooldown):
+			log.Printf("ignored command \"%s\" from %s in %s, it is on cooldown\n", command.Command, msg.User.DisplayName, msg.Channel)
+			return err
+		case err != nil:
+			log.Printf("failed to handle command \"%s\" with params: \"%s\": %v\n", command.Command, command.Args, err)
+			return err
+		}
+		log.Printf("handled command \"%s\" from %s in %s (%s)\n", command.Command, msg.User.DisplayName, msg.Channel, time.Since(start))
+		return nil
+	}
+}
+
+// rejectCommand replies that the sender does not have the given role and returns ErrNotAllowed
+func rejectCommand(client Bot, msg ReducedMessage, role Role) error {
+	err := client.Say(msg.Channel, NotAllowedMessage(msg, role))
+	if err != nil {
+		return fmt.Errorf("%w, requires %s (replying failed: %v)", ErrNotAllowed, role, err)
+	}
+	return fmt.Errorf("%w, requires %s", ErrNotAllowed, role)
+}
+
+// RequireRole rejects the command with a reply when the sender does not have the given role
+func RequireRole(role Role) Middleware {
+	return func(next CommandHandler) CommandHandler {
+		return func(ctx context.Context, client Bot, msg ReducedMessage, command Command) error {
+			if !msg.HasRole(role) {
+				return rejectCommand(client, msg, role)
+			}
+			return next(ctx, client, msg, command)
+		}
+	}
+}
+
+// middleware silently ignores commands that are still on cooldown, returning ErrOnCooldown
+func (ct *cooldownTracker) middleware(next CommandHandler) CommandHandler {
+	return func(ctx context.Context, client Bot, msg ReducedMessage, command Command) error {
+		if !ct.use(command.Command, msg) {
+			return ErrOnCooldown
+		}
+		return next(ctx, client, msg, command)
+	}
+}
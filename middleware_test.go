@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aaron-jencks/gitchbot/storage"
+)
+
+// replyBot records the replies it is asked to send, every other method of Bot is left unimplemented
+type replyBot struct {
+	Bot
+	replies []string
+}
+
+func (rb *replyBot) Say(channel, message string) error {
+	rb.replies = append(rb.replies, message)
+	return nil
+}
+
+func TestLoggingMiddleware(t *testing.T) {
+	cooldowns := createCooldownTracker()
+	cooldowns.set("chan", "lurk", storage.Cooldown{Global: time.Hour})
+	handled := func(ctx context.Context, client Bot, msg ReducedMessage, command Command) error {
+		return nil
+	}
+
+	tests := []struct {
+		name    string
+		command string
+		role    Role
+		log     string
+		replies int
+	}{
+		{"handled", "discord", ROLE_EVERYONE, "handled command \"discord\"", 0},
+		{"rejected", "title", ROLE_MODERATOR, "rejected command \"title\" from someone in chan: not allowed, requires moderator", 1},
+		{"first use", "lurk", ROLE_EVERYONE, "handled command \"lurk\"", 0},
+		{"on cooldown", "lurk", ROLE_EVERYONE, "ignored command \"lurk\" from someone in chan, it is on cooldown", 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var output bytes.Buffer
+			log.SetOutput(&output)
+			defer log.SetOutput(os.Stderr)
+
+			client := &replyBot{}
+			handler := Chain(handled, LoggingMiddleware, RequireRole(test.role), cooldowns.middleware)
+			msg := ReducedMessage{Channel: "chan", Message: "!" + test.command}
+			msg.User.DisplayName = "someone"
+			handler(context.Background(), client, msg, Command{Command: test.command, Prefix: "!"})
+
+			if !strings.Contains(output.String(), test.log) {
+				t.Errorf("logged %q, want it to contain %q", output.String(), test.log)
+			}
+			if len(client.replies) != test.replies {
+				t.Errorf("replied %q, want %d replies", client.replies, test.replies)
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Priority determines the order in which queued outgoing messages are sent,
+// higher priorities are always sent first.
+type Priority int
+
+const (
+	PRIORITY_LOW Priority = iota
+	PRIORITY_NORMAL
+	PRIORITY_HIGH
+)
+
+const (
+	RATE_LIMIT_WINDOW    = 30 * time.Second
+	RATE_LIMIT_USER      = 20
+	RATE_LIMIT_MODERATOR = 100
+	DUPLICATE_WINDOW     = 30 * time.Second
+)
+
+type outgoingMessage struct {
+	channel string
+	text    string
+}
+
+func (om outgoingMessage) key() string {
+	return om.channel + "\x00" + om.text
+}
+
+// outbox queues outgoing chat messages and sends them without exceeding twitch's rate limits,
+// identical messages to the same channel within DUPLICATE_WINDOW are dropped.
+type outbox struct {
+	lock      sync.Mutex
+	queues    [PRIORITY_HIGH + 1][]outgoingMessage
+	pending   map[string]bool
+	recent    map[string]time.Time
+	sent      []time.Time
+	moderator map[string]bool
+	paused    bool
+	wake      chan struct{}
+	send      func(channel, text string)
+}
+
+// createOutbox creates a paused outbox, it should be resumed once connected
+func createOutbox(send func(channel, text string)) *outbox {
+	return &outbox{
+		pending:   map[string]bool{},
+		recent:    map[string]time.Time{},
+		moderator: map[string]bool{},
+		paused:    true,
+		wake:      make(chan struct{}, 1),
+		send:      send,
+	}
+}
+
+// setModerator records whether the bot is a moderator (or the broadcaster) in a channel,
+// which raises the rate limit for messages sent there.
+func (ob *outbox) setModerator(channel string, moderator bool) {
+	ob.lock.Lock()
+	defer ob.lock.Unlock()
+	ob.moderator[channel] = moderator
+}
+
+// setPaused holds queued messages until the outbox is resumed, e.g. while disconnected
+func (ob *outbox) setPaused(paused bool) {
+	ob.lock.Lock()
+	ob.paused = paused
+	ob.lock.Unlock()
+	select {
+	case ob.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (ob *outbox) enqueue(channel, text string, priority Priority) {
+	if priority < PRIORITY_LOW {
+		priority = PRIORITY_LOW
+	} else if priority > PRIORITY_HIGH {
+		priority = PRIORITY_HIGH
+	}
+	msg := outgoingMessage{
+		channel: channel,
+		text:    text,
+	}
+
+	ob.lock.Lock()
+	key := msg.key()
+	if ob.pending[key] {
+		ob.lock.Unlock()
+		log.Printf("dropping duplicate message to %s, it is already queued: %s\n", channel, text)
+		return
+	}
+	if last, ok := ob.recent[key]; ok && time.Since(last) < DUPLICATE_WINDOW {
+		ob.lock.Unlock()
+		log.Printf("dropping duplicate message to %s, it was recently sent: %s\n", channel, text)
+		return
+	}
+	ob.pending[key] = true
+	ob.queues[priority] = append(ob.queues[priority], msg)
+	ob.lock.Unlock()
+
+	select {
+	case ob.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (ob *outbox) empty() bool {
+	ob.lock.Lock()
+	defer ob.lock.Unlock()
+	for _, queue := range ob.queues {
+		if len(queue) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// drain waits until every queued message has been sent or the context is done
+func (ob *outbox) drain(ctx context.Context) error {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for !ob.empty() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// pruneSent must be called while holding the lock
+func (ob *outbox) pruneSent(now time.Time) {
+	cutoff := now.Add(-RATE_LIMIT_WINDOW)
+	idx := 0
+	for idx < len(ob.sent) && !ob.sent[idx].After(cutoff) {
+		idx++
+	}
+	ob.sent = ob.sent[idx:]
+	for key, last := range ob.recent {
+		if now.Sub(last) >= DUPLICATE_WINDOW {
+			delete(ob.recent, key)
+		}
+	}
+}
+
+// next pops the highest priority message if the rate limit allows it to be sent,
+// otherwise it returns how long to wait before trying again.
+// A wait of zero with no message means the queue is empty or paused.
+func (ob *outbox) next() (msg outgoingMessage, ok bool, wait time.Duration) {
+	ob.lock.Lock()
+	defer ob.lock.Unlock()
+	now := time.Now()
+	ob.pruneSent(now)
+	if ob.paused {
+		return msg, false, 0
+	}
+	for priority := PRIORITY_HIGH; priority >= PRIORITY_LOW; priority-- {
+		queue := ob.queues[priority]
+		if len(queue) == 0 {
+			continue
+		}
+		limit := RATE_LIMIT_USER
+		if ob.moderator[queue[0].channel] {
+			limit = RATE_LIMIT_MODERATOR
+		}
+		if len(ob.sent) >= limit {
+			return msg, false, ob.sent[len(ob.sent)-limit].Add(RATE_LIMIT_WINDOW).Sub(now)
+		}
+		msg = queue[0]
+		ob.queues[priority] = queue[1:]
+		delete(ob.pending, msg.key())
+		ob.recent[msg.key()] = now
+		ob.sent = append(ob.sent, now)
+		return msg, true, 0
+	}
+	return msg, false, 0
+}
+
+func (ob *outbox) run(ctx context.Context) {
+	for {
+		msg, ok, wait := ob.next()
+		if ok {
+			ob.send(msg.channel, msg.text)
+			continue
+		}
+		if wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			case <-ob.wake:
+				timer.Stop()
+			}
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ob.wake:
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// createTestOutbox creates a resumed outbox that records the messages it sends
+func createTestOutbox() (*outbox, *[]string) {
+	var sent []string
+	ob := createOutbox(func(channel, text string) {
+		sent = append(sent, text)
+	})
+	ob.setPaused(false)
+	return ob, &sent
+}
+
+// sendReady sends every message that the rate limit allows, it returns the wait for the next one
+func sendReady(ob *outbox) time.Duration {
+	for {
+		msg, ok, wait := ob.next()
+		if !ok {
+			return wait
+		}
+		ob.send(msg.channel, msg.text)
+	}
+}
+
+func TestOutboxPriority(t *testing.T) {
+	ob, sent := createTestOutbox()
+	ob.enqueue("chan", "low", PRIORITY_LOW)
+	ob.enqueue("chan", "normal", PRIORITY_NORMAL)
+	ob.enqueue("chan", "high", PRIORITY_HIGH)
+	ob.enqueue("chan", "second normal", PRIORITY_NORMAL)
+	ob.enqueue("chan", "too high", PRIORITY_HIGH+1)
+	sendReady(ob)
+
+	want := []string{"high", "too high", "normal", "second normal", "low"}
+	if !reflect.DeepEqual(*sent, want) {
+		t.Errorf("sent %q, want %q", *sent, want)
+	}
+}
+
+func TestOutboxRateLimit(t *testing.T) {
+	tests := []struct {
+		name      string
+		moderator bool
+		messages  int
+		sent      int
+	}{
+		{"user", false, RATE_LIMIT_USER + 1, RATE_LIMIT_USER},
+		{"moderator", true, RATE_LIMIT_USER + 1, RATE_LIMIT_USER + 1},
+		{"moderator over its limit", true, RATE_LIMIT_MODERATOR + 1, RATE_LIMIT_MODERATOR},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ob, sent := createTestOutbox()
+			ob.setModerator("chan", test.moderator)
+			for i := 0; i < test.messages; i++ {
+				ob.enqueue("chan", fmt.Sprintf("message %d", i), PRIORITY_NORMAL)
+			}
+			wait := sendReady(ob)
+			if len(*sent) != test.sent {
+				t.Errorf("sent %d messages, want %d", len(*sent), test.sent)
+			}
+			if test.sent < test.messages && (wait <= 0 || wait > RATE_LIMIT_WINDOW) {
+				t.Errorf("wait = %s for a held back message, want up to %s", wait, RATE_LIMIT_WINDOW)
+			}
+			if test.sent == test.messages && wait != 0 {
+				t.Errorf("wait = %s with nothing queued, want 0", wait)
+			}
+		})
+	}
+}
+
+func TestOutboxDuplicates(t *testing.T) {
+	ob, sent := createTestOutbox()
+	ob.enqueue("chan", "hello", PRIORITY_NORMAL)
+	ob.enqueue("chan", "hello", PRIORITY_HIGH)
+	ob.enqueue("other", "hello", PRIORITY_NORMAL)
+	sendReady(ob)
+	if want := []string{"hello", "hello"}; !reflect.DeepEqual(*sent, want) {
+		t.Errorf("sent %q while a duplicate was pending, want %q", *sent, want)
+	}
+
+	ob.enqueue("chan", "hello", PRIORITY_NORMAL)
+	ob.enqueue("chan", "goodbye", PRIORITY_NORMAL)
+	sendReady(ob)
+	if want := []string{"hello", "hello", "goodbye"}; !reflect.DeepEqual(*sent, want) {
+		t.Errorf("sent %q after a recently sent duplicate, want %q", *sent, want)
+	}
+}
+
+func TestOutboxPaused(t *testing.T) {
+	ob, sent := createTestOutbox()
+	ob.setPaused(true)
+	ob.enqueue("chan", "hello", PRIORITY_HIGH)
+	if wait := sendReady(ob); wait != 0 {
+		t.Errorf("wait = %s while paused, want 0", wait)
+	}
+	if len(*sent) != 0 || ob.empty() {
+		t.Errorf("sent %q while paused, want the message to stay queued", *sent)
+	}
+
+	ob.setPaused(false)
+	sendReady(ob)
+	if want := []string{"hello"}; !reflect.DeepEqual(*sent, want) {
+		t.Errorf("sent %q once resumed, want %q", *sent, want)
+	}
+}
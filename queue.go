@@ -1,11 +1,16 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/oriser/regroup"
+	"github.com/aaron-jencks/gitchbot/storage"
 )
 
 type HelpEntry struct {
@@ -14,39 +19,70 @@ type HelpEntry struct {
 	Code     string
 }
 
-type HelpCommand struct {
-	Command string
-	Entry   HelpEntry
-	Error   string
-}
+const PASTEBIN_PREFIX = "https://pastebin.com/"
 
-var HELP_REGEX = regroup.MustCompile(`(?P<command>about|position|pop|put)(\s+"(?P<message>.{20,120})"(\s+https://pastebin\.com/(?P<url>\w+))?)?`)
+const HELP_QUEUE_STATE = "help_queue"
 
-const HELP_USAGE = "!help (about|position|pop|put \"message/request (20-120 chars)\" [https://pastebin.com/...])"
+var helpQueueLock sync.Mutex = sync.Mutex{}
+var helpQueues map[string][]HelpEntry = map[string][]HelpEntry{}
 
-var helpQueue []HelpEntry
+func parseHelpEntry(username string, args Args) (entry HelpEntry, err error) {
+	entry.Username = username
+	entry.Message = args.String("message")
+	url := args.String("pastebin")
+	if url != "" {
+		if !strings.HasPrefix(url, PASTEBIN_PREFIX) || len(url) == len(PASTEBIN_PREFIX) {
+			err = fmt.Errorf("code must be a %s link", PASTEBIN_PREFIX)
+			return
+		}
+		entry.Code = strings.TrimPrefix(url, PASTEBIN_PREFIX)
+	}
+	return
+}
 
-func parseHelpRequest(username, line string) (entry HelpCommand, err error) {
-	matches, err := HELP_REGEX.Groups(line)
+// SaveHelpQueue persists the channel's help queue so that it survives a restart
+func SaveHelpQueue(b Bot, channel string) error {
+	channel = normalizeChannel(channel)
+	helpQueueLock.Lock()
+	defer helpQueueLock.Unlock()
+	data, err := json.Marshal(helpQueues[channel])
 	if err != nil {
-		return
+		return err
 	}
-	entry.Command = matches["command"]
-	var ok bool
-	switch matches["command"] {
-	case "put":
-		entry.Entry.Username = username
-		entry.Entry.Message, ok = matches["message"]
-		if !ok {
-			entry.Error = "message is required for enqueueing help requests"
-		}
-		entry.Entry.Code = matches["url"]
+	return b.Storage(channel).SaveState(HELP_QUEUE_STATE, string(data))
+}
+
+// LoadHelpQueue restores the channel's help queue saved by SaveHelpQueue, the saved queue is deleted
+// once loaded so that a crash after this point cannot bring back requests that were already popped.
+func LoadHelpQueue(b Bot, channel string) error {
+	channel = normalizeChannel(channel)
+	backing := b.Storage(channel)
+	data, err := backing.RetrieveState(HELP_QUEUE_STATE)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil
 	}
-	return
+	if err != nil {
+		return err
+	}
+	var queue []HelpEntry
+	err = json.Unmarshal([]byte(data), &queue)
+	if err != nil {
+		return err
+	}
+	err = backing.DeleteState(HELP_QUEUE_STATE)
+	if err != nil {
+		return err
+	}
+	helpQueueLock.Lock()
+	defer helpQueueLock.Unlock()
+	helpQueues[channel] = queue
+	log.Printf("loaded %d help requests in %s\n", len(queue), channel)
+	return nil
 }
 
-func getUserHelpPosition(username string) int {
-	for hi, entry := range helpQueue {
+// getUserHelpPosition must be called while holding helpQueueLock
+func getUserHelpPosition(channel, username string) int {
+	for hi, entry := range helpQueues[channel] {
 		if entry.Username == username {
 			return hi
 		}
@@ -54,49 +90,96 @@ func getUserHelpPosition(username string) int {
 	return -1
 }
 
-func CreateProgrammingHelpQueue(b Bot) error {
-	log.Println("creating hooks for programming help queue")
-	b.RegisterHandler("help", func(client Bot, msg ReducedMessage, command Command) error {
-		entry, err := parseHelpRequest(msg.User.DisplayName, msg.Message)
-		if err != nil {
-			return client.Say(fmt.Sprintf("@%s that usage is incorrect, correct usage is: %s", msg.User.DisplayName, HELP_USAGE))
-		}
-		if entry.Error != "" {
-			return client.Say(fmt.Sprintf("@%s there is an error in your request: \"%s\" (see \"!help about\" for usage details)", msg.User.DisplayName, entry.Error))
-		}
-		switch entry.Command {
-		case "about":
-			return client.Say(HELP_USAGE)
-		case "position":
-			idx := getUserHelpPosition(msg.User.DisplayName)
+func createHelpRouter() *Router {
+	router := CreateRouter()
+	router.Handle(Subcommand{
+		Name:        "about",
+		Description: "explains how to use the queue",
+		Handler: func(ctx context.Context, client Bot, msg ReducedMessage, command Command, args Args) error {
+			return client.Say(msg.Channel, router.Details(command.Prefix, command.Command, msg.Role()))
+		},
+	})
+	router.Handle(Subcommand{
+		Name:        "position",
+		Description: "shows where your request is in the queue",
+		Handler: func(ctx context.Context, client Bot, msg ReducedMessage, command Command, args Args) error {
+			helpQueueLock.Lock()
+			defer helpQueueLock.Unlock()
+			idx := getUserHelpPosition(msg.Channel, msg.User.DisplayName)
 			if idx < 0 {
-				return client.Say(fmt.Sprintf("@%s you do not have a request queued at the moment", msg.User.DisplayName))
-			} else {
-				return client.Say(fmt.Sprintf("@%s you are position %d in the queue", msg.User.DisplayName, idx))
-			}
-		case "put":
-			idx := getUserHelpPosition(msg.User.DisplayName)
-			if idx >= 0 {
-				return client.Say(fmt.Sprintf("@%s you already have a help request in the queue, please wait your turn, you are at position %d", msg.User.DisplayName, idx))
-			}
-			helpQueue = append(helpQueue, entry.Entry)
-			return client.Say(fmt.Sprintf("@%s you have been added to the queue, you are at position %d", msg.User.DisplayName, len(helpQueue)-1))
-		case "pop":
-			if !msg.IsModerator() {
-				return client.Say(fmt.Sprintf("@%s you must be a moderator to do that", msg.User.DisplayName))
+				return client.Say(msg.Channel, fmt.Sprintf("@%s you do not have a request queued at the moment", msg.User.DisplayName))
 			}
+			return client.Say(msg.Channel, fmt.Sprintf("@%s you are position %d in the queue", msg.User.DisplayName, idx))
+		},
+	})
+	router.Handle(Subcommand{
+		Name:        "pop",
+		Description: "takes the next request from the queue",
+		Role:        ROLE_MODERATOR,
+		Handler: func(ctx context.Context, client Bot, msg ReducedMessage, command Command, args Args) error {
+			helpQueueLock.Lock()
+			defer helpQueueLock.Unlock()
+			helpQueue := helpQueues[msg.Channel]
 			if len(helpQueue) == 0 {
-				return client.Say(fmt.Sprintf("@%s you're all caught up!", msg.User.DisplayName))
+				return client.Say(msg.Channel, fmt.Sprintf("@%s you're all caught up!", msg.User.DisplayName))
 			}
 			entry := helpQueue[0]
-			helpQueue = helpQueue[1:]
+			helpQueues[msg.Channel] = helpQueue[1:]
 			template := fmt.Sprintf("@%s %s asks, \"%s\"", msg.User.DisplayName, entry.Username, entry.Message)
 			if entry.Code != "" {
-				template += fmt.Sprintf(" they have provided code: https://pastebin.com/%s", entry.Code)
+				template += fmt.Sprintf(" they have provided code: %s%s", PASTEBIN_PREFIX, entry.Code)
+			}
+			return client.Say(msg.Channel, template)
+		},
+	})
+	router.Handle(Subcommand{
+		Name:        "put",
+		Description: "adds your request to the queue",
+		Args: ArgSchema{
+			{Name: "message", Type: ARG_STRING, MinLen: 20, MaxLen: 120},
+			{Name: "pastebin", Optional: true},
+		},
+		Handler: func(ctx context.Context, client Bot, msg ReducedMessage, command Command, args Args) error {
+			entry, err := parseHelpEntry(msg.User.DisplayName, args)
+			if err != nil {
+				return client.Say(msg.Channel, fmt.Sprintf("@%s there is an error in your request: \"%v\" (see \"%s%s about\" for usage details)", msg.User.DisplayName, err, command.Prefix, command.Command))
+			}
+			helpQueueLock.Lock()
+			defer helpQueueLock.Unlock()
+			idx := getUserHelpPosition(msg.Channel, msg.User.DisplayName)
+			if idx >= 0 {
+				return client.Say(msg.Channel, fmt.Sprintf("@%s you already have a help request in the queue, please wait your turn, you are at position %d", msg.User.DisplayName, idx))
 			}
-			return client.Say(template)
+			helpQueues[msg.Channel] = append(helpQueues[msg.Channel], entry)
+			return client.Say(msg.Channel, fmt.Sprintf("@%s you have been added to the queue, you are at position %d", msg.User.DisplayName, len(helpQueues[msg.Channel])-1))
+		},
+	})
+	return router
+}
+
+func CreateProgrammingHelpQueue(b Bot, channel string) error {
+	log.Printf("creating hooks for programming help queue in %s\n", channel)
+	err := LoadHelpQueue(b, channel)
+	if err != nil {
+		// a queue that cannot be loaded should not take the command down with it
+		log.Printf("failed to load help queue for %s, starting with an empty queue: %v\n", channel, err)
+	}
+	// the queue is saved once no handlers can change it anymore
+	b.OnStop(func(client Bot) {
+		err := SaveHelpQueue(client, channel)
+		if err != nil {
+			log.Printf("failed to save help queue for %s: %v\n", channel, err)
 		}
-		return nil
 	})
-	return CreateTimer(b, "help_timer", "Want to ask a question? Now you can use the queue! See \"!help about\" for usage", 1*time.Minute)
+	router := createHelpRouter()
+	b.RegisterHandler(channel, HandlerInfo{
+		Name:        "help",
+		Description: "queue a programming question for the streamer to help with",
+		Usage:       router.Usage("help"),
+	}, router.Handler())
+	prefix := DEFAULT_PREFIX
+	if prefixes := b.Prefixes(channel); len(prefixes) > 0 {
+		prefix = prefixes[0]
+	}
+	return CreateTimer(b, channel, "help_timer", fmt.Sprintf("Want to ask a question? Now you can use the queue! See \"%shelp about\" for usage", prefix), 1*time.Minute)
 }
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"sort"
+	"sync"
+)
+
+// HandlerInfo describes a command so that viewers can discover how to use it
+type HandlerInfo struct {
+	Name        string
+	Description string
+	Usage       string // generated from the name when empty
+	Role        Role
+}
+
+type registeredHandler struct {
+	info    HandlerInfo
+	handler CommandHandler
+}
+
+// handlerRegistry holds the handlers and aliases for each channel,
+// it is safe to use from handlers and other goroutines while the bot is running.
+type handlerRegistry struct {
+	lock     sync.RWMutex
+	handlers map[string]map[string]registeredHandler
+	aliases  map[string]map[string]string
+	global   []Middleware
+	prefixes map[string][]string
+}
+
+func createHandlerRegistry() *handlerRegistry {
+	return &handlerRegistry{
+		handlers: map[string]map[string]registeredHandler{
+			ALL_CHANNELS: {},
+		},
+		aliases: map[string]map[string]string{
+			ALL_CHANNELS: {},
+		},
+		prefixes: map[string][]string{
+			ALL_CHANNELS: {DEFAULT_PREFIX},
+		},
+	}
+}
+
+func (hr *handlerRegistry) setPrefixes(channel string, prefixes []string) {
+	hr.lock.Lock()
+	defer hr.lock.Unlock()
+	var result []string
+	for _, prefix := range prefixes {
+		if prefix != "" {
+			result = append(result, prefix)
+		}
+	}
+	if len(result) == 0 && channel != ALL_CHANNELS {
+		delete(hr.prefixes, channel)
+		return
+	}
+	hr.prefixes[channel] = result
+}
+
+// getPrefixes returns the channel's prefixes, falling back to the prefixes for all channels
+func (hr *handlerRegistry) getPrefixes(channel string) []string {
+	hr.lock.RLock()
+	defer hr.lock.RUnlock()
+	prefixes, ok := hr.prefixes[channel]
+	if !ok {
+		prefixes = hr.prefixes[ALL_CHANNELS]
+	}
+	result := make([]string, len(prefixes))
+	copy(result, prefixes)
+	return result
+}
+
+func (hr *handlerRegistry) use(middlewares ...Middleware) {
+	hr.lock.Lock()
+	defer hr.lock.Unlock()
+	hr.global = append(hr.global, middlewares...)
+}
+
+// middlewares returns a copy of the global middlewares
+func (hr *handlerRegistry) middlewares() []Middleware {
+	hr.lock.RLock()
+	defer hr.lock.RUnlock()
+	result := make([]Middleware, len(hr.global), len(hr.global)+2)
+	copy(result, hr.global)
+	return result
+}
+
+// exists determines if a handler is available in the channel, including the handlers for all channels,
+// so that a channel's commands cannot shadow the built in ones
+func (hr *handlerRegistry) exists(channel, name string) bool {
+	_, ok := hr.find(channel, name)
+	return ok
+}
+
+func (hr *handlerRegistry) register(channel string, handler registeredHandler) {
+	hr.lock.Lock()
+	defer hr.lock.Unlock()
+	registry, ok := hr.handlers[channel]
+	if !ok {
+		registry = map[string]registeredHandler{}
+		hr.handlers[channel] = registry
+	}
+	registry[handler.info.Name] = handler
+}
+
+func (hr *handlerRegistry) unregister(channel, name string) {
+	hr.lock.Lock()
+	defer hr.lock.Unlock()
+	delete(hr.handlers[channel], name)
+}
+
+func (hr *handlerRegistry) registerAlias(channel, alias, target string) {
+	hr.lock.Lock()
+	defer hr.lock.Unlock()
+	registry, ok := hr.aliases[channel]
+	if !ok {
+		registry = map[string]string{}
+		hr.aliases[channel] = registry
+	}
+	registry[alias] = target
+}
+
+func (hr *handlerRegistry) unregisterAlias(channel, alias string) {
+	hr.lock.Lock()
+	defer hr.lock.Unlock()
+	delete(hr.aliases[channel], alias)
+}
+
+// resolveAlias returns the name of the command an alias refers to,
+// names that are not aliases are returned unchanged.
+func (hr *handlerRegistry) resolveAlias(channel, name string) string {
+	hr.lock.RLock()
+	defer hr.lock.RUnlock()
+	if target, ok := hr.aliases[channel][name]; ok {
+		return target
+	}
+	if target, ok := hr.aliases[ALL_CHANNELS][name]; ok {
+		return target
+	}
+	return name
+}
+
+// find looks up a command in the channel's registry first and
+// falls back to the handlers registered for all channels.
+func (hr *handlerRegistry) find(channel, name string) (registeredHandler, bool) {
+	hr.lock.RLock()
+	defer hr.lock.RUnlock()
+	if handler, ok := hr.handlers[channel][name]; ok {
+		return handler, true
+	}
+	handler, ok := hr.handlers[ALL_CHANNELS][name]
+	return handler, ok
+}
+
+// list returns the info of every handler available in the channel, sorted by name
+func (hr *handlerRegistry) list(channel string) []HandlerInfo {
+	hr.lock.RLock()
+	defer hr.lock.RUnlock()
+	infos := map[string]HandlerInfo{}
+	for name, handler := range hr.handlers[ALL_CHANNELS] {
+		infos[name] = handler.info
+	}
+	for name, handler := range hr.handlers[channel] {
+		infos[name] = handler.info
+	}
+	result := make([]HandlerInfo, 0, len(infos))
+	for _, info := range infos {
+		result = append(result, info)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// listAliases returns the aliases available in the channel and the commands they refer to
+func (hr *handlerRegistry) listAliases(channel string) map[string]string {
+	hr.lock.RLock()
+	defer hr.lock.RUnlock()
+	result := map[string]string{}
+	for alias, target := range hr.aliases[ALL_CHANNELS] {
+		result[alias] = target
+	}
+	for alias, target := range hr.aliases[channel] {
+		result[alias] = target
+	}
+	return result
+}
@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestRegistryExists(t *testing.T) {
+	hr := createHandlerRegistry()
+	hr.register(ALL_CHANNELS, registeredHandler{info: HandlerInfo{Name: "title"}})
+	hr.register("chan", registeredHandler{info: HandlerInfo{Name: "lurk"}})
+
+	tests := []struct {
+		channel string
+		name    string
+		want    bool
+	}{
+		{"chan", "lurk", true},
+		{"chan", "title", true},
+		{ALL_CHANNELS, "title", true},
+		{"other", "title", true},
+		{"other", "lurk", false},
+		{"chan", "discord", false},
+	}
+	for _, test := range tests {
+		if got := hr.exists(test.channel, test.name); got != test.want {
+			t.Errorf("exists(%q, %q) = %v, want %v", test.channel, test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Subcommand is a single action of a command handled by a Router, e.g. the "put" in "!help put"
+type Subcommand struct {
+	Name        string
+	Description string
+	Role        Role
+	Args        ArgSchema
+	Handler     ArgsHandler
+}
+
+// Router dispatches a command to one of its subcommands based on the first argument,
+// checking the subcommand's role and parsing its arguments before it is called.
+type Router struct {
+	subcommands map[string]Subcommand
+	order       []string
+}
+
+func CreateRouter() *Router {
+	return &Router{
+		subcommands: map[string]Subcommand{},
+	}
+}
+
+// Handle adds a subcommand to the router, subcommands are listed in the order they are added
+func (r *Router) Handle(sub Subcommand) {
+	if _, ok := r.subcommands[sub.Name]; !ok {
+		r.order = append(r.order, sub.Name)
+	}
+	r.subcommands[sub.Name] = sub
+}
+
+// Usage generates the usage of the command, e.g. "help <about|position|pop|put>"
+func (r *Router) Usage(command string) string {
+	return fmt.Sprintf("%s <%s>", command, strings.Join(r.order, "|"))
+}
+
+// SubcommandUsage generates the usage of a single subcommand, e.g. "help put \"message\""
+func (r *Router) SubcommandUsage(command, name string) string {
+	sub, ok := r.subcommands[name]
+	if !ok {
+		return r.Usage(command)
+	}
+	return sub.Args.Usage(command + " " + sub.Name)
+}
+
+// Details generates the usage of every subcommand the role is allowed to use, separated by " | "
+func (r *Router) Details(prefix, command string, role Role) string {
+	var usages []string
+	for _, name := range r.order {
+		if role >= r.subcommands[name].Role {
+			usages = append(usages, prefix+r.SubcommandUsage(command, name))
+		}
+	}
+	return strings.Join(usages, " | ")
+}
+
+// Handler creates the CommandHandler that dispatches to the subcommands
+func (r *Router) Handler() CommandHandler {
+	return func(ctx context.Context, client Bot, msg ReducedMessage, command Command) error {
+		line := strings.TrimSpace(command.Args)
+		name := line
+		rest := ""
+		if idx := strings.IndexFunc(line, unicode.IsSpace); idx >= 0 {
+			name = line[:idx]
+			rest = line[idx:]
+		}
+		sub, ok := r.subcommands[strings.ToLower(name)]
+		if !ok {
+			return client.Say(msg.Channel, fmt.Sprintf("@%s usage: %s%s", msg.User.DisplayName, command.Prefix, r.Usage(command.Command)))
+		}
+		if !msg.HasRole(sub.Role) {
+			return rejectCommand(client, msg, sub.Role)
+		}
+		args, err := sub.Args.Parse(rest)
+		if err != nil {
+			return client.Say(msg.Channel, fmt.Sprintf("@%s %v, usage: %s%s", msg.User.DisplayName, err, command.Prefix, r.SubcommandUsage(command.Command, sub.Name)))
+		}
+		command.Args = strings.TrimSpace(rest)
+		return sub.Handler(ctx, client, msg, command, args)
+	}
+}
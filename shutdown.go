@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Shutdown stops the bot gracefully, it posts the goodbye message (if any) to every channel,
+// waits for queued messages to be sent and then stops the bot, which persists the help queues
+// once no more commands are being handled.
+func Shutdown(b Bot, goodbye string, timeout time.Duration) error {
+	log.Println("shutting down...")
+	if goodbye != "" {
+		for _, channel := range b.Channels() {
+			err := b.Say(channel, goodbye)
+			if err != nil {
+				log.Printf("failed to say goodbye in %s: %v\n", channel, err)
+			}
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	err := b.Flush(ctx)
+	if err != nil {
+		log.Printf("failed to send all queued messages before shutting down: %v\n", err)
+	}
+
+	return b.Stop()
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const ELLIPSIS = "..."
+
+// TruncateMessage shortens a message to fit within MAX_MSG_LEN characters,
+// ending it with an ellipsis, handlers can use this when splitting the message is undesirable.
+func TruncateMessage(text string) string {
+	return truncateToLength(text, MAX_MSG_LEN)
+}
+
+func truncateToLength(text string, limit int) string {
+	if utf8.RuneCountInString(text) <= limit {
+		return text
+	}
+	budget := limit - utf8.RuneCountInString(ELLIPSIS)
+	if budget <= 0 {
+		return string([]rune(ELLIPSIS)[:limit])
+	}
+	runes := []rune(text)[:budget]
+	trimmed := strings.TrimRight(string(runes), " ")
+	// prefer to cut at a word boundary so emotes and links are not broken in half
+	if idx := strings.LastIndex(trimmed, " "); idx > 0 {
+		trimmed = strings.TrimRight(trimmed[:idx], " ")
+	}
+	return trimmed + ELLIPSIS
+}
+
+// splitWords breaks text into chunks of at most limit characters on word boundaries,
+// words longer than the limit are split wherever they need to be.
+func splitWords(text string, limit int) []string {
+	var chunks []string
+	var current []string
+	currentLen := 0
+	for _, word := range strings.Fields(text) {
+		wordLen := utf8.RuneCountInString(word)
+		for wordLen > limit {
+			if len(current) > 0 {
+				chunks = append(chunks, strings.Join(current, " "))
+				current = nil
+				currentLen = 0
+			}
+			runes := []rune(word)
+			chunks = append(chunks, string(runes[:limit]))
+			word = string(runes[limit:])
+			wordLen -= limit
+		}
+		if wordLen == 0 {
+			continue
+		}
+		if len(current) > 0 && currentLen+1+wordLen > limit {
+			chunks = append(chunks, strings.Join(current, " "))
+			current = nil
+			currentLen = 0
+		}
+		if len(current) > 0 {
+			currentLen++
+		}
+		current = append(current, word)
+		currentLen += wordLen
+	}
+	if len(current) > 0 {
+		chunks = append(chunks, strings.Join(current, " "))
+	}
+	return chunks
+}
+
+// SplitMessage breaks a message that is too long for a single chat message into
+// numbered chunks, e.g. "(1/3) ...", that each fit within limit characters.
+func SplitMessage(text string, limit int) []string {
+	if utf8.RuneCountInString(text) <= limit {
+		return []string{text}
+	}
+	// the prefix length depends on how many chunks there are, so grow it until it is large enough
+	for digits := 1; ; digits++ {
+		prefixLen := 2*digits + len("(/) ")
+		if prefixLen >= limit {
+			return []string{truncateToLength(text, limit)}
+		}
+		chunks := splitWords(text, limit-prefixLen)
+		if len(fmt.Sprint(len(chunks))) > digits {
+			continue
+		}
+		for ci := range chunks {
+			chunks[ci] = fmt.Sprintf("(%d/%d) %s", ci+1, len(chunks), chunks[ci])
+		}
+		return chunks
+	}
+}
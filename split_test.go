@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateToLength(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		limit int
+		want  string
+	}{
+		{"fits", "hello world", 11, "hello world"},
+		{"word boundary", "hello there world", 14, "hello..."},
+		{"single long word", "abcdefghij", 8, "abcde..."},
+		{"multi-byte", "héllo wörld ünïcode", 13, "héllo..."},
+		{"emoji", "😀😀😀😀😀😀", 5, "😀😀..."},
+		{"limit of the ellipsis", "hello world", 3, "..."},
+		{"limit smaller than the ellipsis", "hello world", 2, ".."},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := truncateToLength(test.text, test.limit)
+			if got != test.want {
+				t.Errorf("truncateToLength(%q, %d) = %q, want %q", test.text, test.limit, got, test.want)
+			}
+			if utf8.RuneCountInString(got) > test.limit {
+				t.Errorf("truncateToLength(%q, %d) = %q is longer than the limit", test.text, test.limit, got)
+			}
+		})
+	}
+}
+
+// checkChunks checks that every chunk fits, is numbered in order and that together they hold every word of text
+func checkChunks(t *testing.T, text string, limit int, chunks []string) {
+	t.Helper()
+	var words []string
+	for ci, chunk := range chunks {
+		if length := utf8.RuneCountInString(chunk); length > limit {
+			t.Errorf("chunk %d is %d characters, over the limit of %d: %q", ci+1, length, limit, chunk)
+		}
+		prefix := fmt.Sprintf("(%d/%d) ", ci+1, len(chunks))
+		if !strings.HasPrefix(chunk, prefix) {
+			t.Fatalf("chunk %d = %q, want it to start with %q", ci+1, chunk, prefix)
+		}
+		words = append(words, strings.TrimPrefix(chunk, prefix))
+	}
+	// words longer than the limit are split across chunks, so compare without any spacing
+	joined := strings.Join(strings.Fields(strings.Join(words, "")), "")
+	if want := strings.Join(strings.Fields(text), ""); joined != want {
+		t.Errorf("chunks hold %q, want %q", joined, want)
+	}
+}
+
+func TestSplitMessage(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		limit  int
+		chunks int
+	}{
+		{"multi-byte", strings.Repeat("héllo wörld ", 60), MAX_MSG_LEN, 2},
+		{"emoji", strings.Repeat("😀 ", 300), MAX_MSG_LEN, 2},
+		{"word over the limit", strings.Repeat("a", 600), MAX_MSG_LEN, 2},
+		{"multi-byte word over the limit", "start " + strings.Repeat("é", 1200) + " end", MAX_MSG_LEN, 4},
+		{"more than 9 chunks", strings.Repeat("word ", 300), 50, 38},
+		{"more than 99 chunks", strings.Repeat("ab ", 400), 12, 400},
+		{"small limit", "one two three four", 8, 9},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			chunks := SplitMessage(test.text, test.limit)
+			if len(chunks) != test.chunks {
+				t.Errorf("SplitMessage made %d chunks, want %d", len(chunks), test.chunks)
+			}
+			checkChunks(t, test.text, test.limit, chunks)
+		})
+	}
+}
+
+func TestSplitMessageEdgeCases(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		limit int
+		want  []string
+	}{
+		{"fits", "hello world", MAX_MSG_LEN, []string{"hello world"}},
+		{"fits exactly in characters", strings.Repeat("é", 10), 10, []string{strings.Repeat("é", 10)}},
+		{"three chunks", "aaaa bbbb cccc", 10, []string{"(1/3) aaaa", "(2/3) bbbb", "(3/3) cccc"}},
+		{"limit too small for numbering", "hello world", 6, []string{"hel..."}},
+		{"limit smaller than the ellipsis", "hello world", 2, []string{".."}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := SplitMessage(test.text, test.limit)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("SplitMessage(%q, %d) = %q, want %q", test.text, test.limit, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,501 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrNoDatabase is returned by GetDbConn for stores that are not backed by a database
+var ErrNoDatabase = errors.New("the store is not backed by a database")
+
+type memoryCounter struct {
+	value  int
+	prefix string
+}
+
+type memoryTimer struct {
+	message  string
+	interval time.Duration
+	next     time.Time
+}
+
+type memoryAlert struct {
+	template string
+	minimum  int
+}
+
+// MemoryBackingStore keeps everything in memory, it behaves the same as the sqlite store
+// but is lost when the bot stops, which makes it useful for throwaway runs and tests.
+type MemoryBackingStore struct {
+	lock      sync.RWMutex
+	closed    bool
+	counters  map[string]memoryCounter
+	timers    map[string]memoryTimer
+	mappings  map[string]string
+	cooldowns map[string]Cooldown
+	aliases   map[string]string
+	alerts    map[string]memoryAlert
+	state     map[string]string
+}
+
+func CreateMemoryBacker() *MemoryBackingStore {
+	return &MemoryBackingStore{
+		counters:  map[string]memoryCounter{},
+		timers:    map[string]memoryTimer{},
+		mappings:  map[string]string{},
+		cooldowns: map[string]Cooldown{},
+		aliases:   map[string]string{},
+		alerts:    map[string]memoryAlert{},
+		state:     map[string]string{},
+	}
+}
+
+func (ms *MemoryBackingStore) GetDbConn() (*sql.DB, error) {
+	return nil, ErrNoDatabase
+}
+
+// Close discards the contents of the store, any later calls fail with ErrClosed
+func (ms *MemoryBackingStore) Close() error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	if ms.closed {
+		return nil
+	}
+	ms.closed = true
+	ms.counters = nil
+	ms.timers = nil
+	ms.mappings = nil
+	ms.cooldowns = nil
+	ms.aliases = nil
+	ms.alerts = nil
+	ms.state = nil
+	return nil
+}
+
+// sortedKeys returns the keys of the map in order, as the sqlite store lists them
+func sortedKeys[V any](items map[string]V) []string {
+	result := make([]string, 0, len(items))
+	for key := range items {
+		result = append(result, key)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func copyMap[V any](items map[string]V) map[string]V {
+	result := make(map[string]V, len(items))
+	for key, value := range items {
+		result[key] = value
+	}
+	return result
+}
+
+func (ms *MemoryBackingStore) CreateCounter(name string, initial int, prefix string) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	if ms.closed {
+		return ErrClosed
+	}
+	if _, ok := ms.counters[name]; ok {
+		return ErrAlreadyExists
+	}
+	ms.counters[name] = memoryCounter{value: initial, prefix: prefix}
+	return nil
+}
+
+func (ms *MemoryBackingStore) RetrieveCounter(name string) (int, string, error) {
+	ms.lock.RLock()
+	defer ms.lock.RUnlock()
+	if ms.closed {
+		return 0, "", ErrClosed
+	}
+	counter, ok := ms.counters[name]
+	if !ok {
+		return 0, "", ErrNotFound
+	}
+	return counter.value, counter.prefix, nil
+}
+
+func (ms *MemoryBackingStore) UpdateCounter(name string, newValue int) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	if ms.closed {
+		return ErrClosed
+	}
+	counter, ok := ms.counters[name]
+	if !ok {
+		return ErrNotFound
+	}
+	counter.value = newValue
+	ms.counters[name] = counter
+	return nil
+}
+
+// IncrementCounter atomically adds delta to the counter and returns its new value
+func (ms *MemoryBackingStore) IncrementCounter(name string, delta int) (int, error) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	if ms.closed {
+		return 0, ErrClosed
+	}
+	counter, ok := ms.counters[name]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	counter.value += delta
+	ms.counters[name] = counter
+	return counter.value, nil
+}
+
+func (ms *MemoryBackingStore) DeleteCounter(name string) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	if ms.closed {
+		return ErrClosed
+	}
+	if _, ok := ms.counters[name]; !ok {
+		return ErrNotFound
+	}
+	delete(ms.counters, name)
+	return nil
+}
+
+func (ms *MemoryBackingStore) ListCounters() ([]string, error) {
+	ms.lock.RLock()
+	defer ms.lock.RUnlock()
+	if ms.closed {
+		return nil, ErrClosed
+	}
+	return sortedKeys(ms.counters), nil
+}
+
+// nextTimerTime determines when a timer next fires, the sqlite store keeps times
+// to the second so they are truncated here as well.
+func nextTimerTime(interval time.Duration) time.Time {
+	return time.Now().Add(interval).Truncate(time.Second)
+}
+
+func (ms *MemoryBackingStore) CreateTimer(name, message string, interval time.Duration) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	if ms.closed {
+		return ErrClosed
+	}
+	if _, ok := ms.timers[name]; ok {
+		return ErrAlreadyExists
+	}
+	ms.timers[name] = memoryTimer{
+		message:  message,
+		interval: interval,
+		next:     nextTimerTime(interval),
+	}
+	return nil
+}
+
+func (ms *MemoryBackingStore) RetrieveTimer(name string) (string, time.Duration, time.Time, error) {
+	ms.lock.RLock()
+	defer ms.lock.RUnlock()
+	if ms.closed {
+		return "", 0, time.Time{}, ErrClosed
+	}
+	timer, ok := ms.timers[name]
+	if !ok {
+		return "", 0, time.Time{}, ErrNotFound
+	}
+	return timer.message, timer.interval, timer.next, nil
+}
+
+func (ms *MemoryBackingStore) ResetTimer(name string) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	if ms.closed {
+		return ErrClosed
+	}
+	timer, ok := ms.timers[name]
+	if !ok {
+		return ErrNotFound
+	}
+	timer.next = nextTimerTime(timer.interval)
+	ms.timers[name] = timer
+	return nil
+}
+
+func (ms *MemoryBackingStore) DeleteTimer(name string) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	if ms.closed {
+		return ErrClosed
+	}
+	if _, ok := ms.timers[name]; !ok {
+		return ErrNotFound
+	}
+	delete(ms.timers, name)
+	return nil
+}
+
+func (ms *MemoryBackingStore) ListTimers() (map[string]time.Time, error) {
+	ms.lock.RLock()
+	defer ms.lock.RUnlock()
+	if ms.closed {
+		return nil, ErrClosed
+	}
+	result := make(map[string]time.Time, len(ms.timers))
+	for name, timer := range ms.timers {
+		result[name] = timer.next
+	}
+	return result, nil
+}
+
+func (ms *MemoryBackingStore) CreateMapping(name, message string) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	if ms.closed {
+		return ErrClosed
+	}
+	if _, ok := ms.mappings[name]; ok {
+		return ErrAlreadyExists
+	}
+	ms.mappings[name] = message
+	return nil
+}
+
+func (ms *MemoryBackingStore) RetrieveMapping(name string) (string, error) {
+	ms.lock.RLock()
+	defer ms.lock.RUnlock()
+	if ms.closed {
+		return "", ErrClosed
+	}
+	message, ok := ms.mappings[name]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return message, nil
+}
+
+func (ms *MemoryBackingStore) UpdateMapping(name, newMessage string) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	if ms.closed {
+		return ErrClosed
+	}
+	if _, ok := ms.mappings[name]; !ok {
+		return ErrNotFound
+	}
+	ms.mappings[name] = newMessage
+	return nil
+}
+
+func (ms *MemoryBackingStore) DeleteMapping(name string) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	if ms.closed {
+		return ErrClosed
+	}
+	if _, ok := ms.mappings[name]; !ok {
+		return ErrNotFound
+	}
+	delete(ms.mappings, name)
+	return nil
+}
+
+func (ms *MemoryBackingStore) ListMappings() (map[string]string, error) {
+	ms.lock.RLock()
+	defer ms.lock.RUnlock()
+	if ms.closed {
+		return nil, ErrClosed
+	}
+	return copyMap(ms.mappings), nil
+}
+
+func (ms *MemoryBackingStore) SetCooldown(name string, cooldown Cooldown) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	if ms.closed {
+		return ErrClosed
+	}
+	ms.cooldowns[name] = cooldown
+	return nil
+}
+
+func (ms *MemoryBackingStore) RetrieveCooldown(name string) (Cooldown, error) {
+	ms.lock.RLock()
+	defer ms.lock.RUnlock()
+	if ms.closed {
+		return Cooldown{}, ErrClosed
+	}
+	cooldown, ok := ms.cooldowns[name]
+	if !ok {
+		return Cooldown{}, ErrNotFound
+	}
+	return cooldown, nil
+}
+
+func (ms *MemoryBackingStore) DeleteCooldown(name string) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	if ms.closed {
+		return ErrClosed
+	}
+	if _, ok := ms.cooldowns[name]; !ok {
+		return ErrNotFound
+	}
+	delete(ms.cooldowns, name)
+	return nil
+}
+
+func (ms *MemoryBackingStore) ListCooldowns() (map[string]Cooldown, error) {
+	ms.lock.RLock()
+	defer ms.lock.RUnlock()
+	if ms.closed {
+		return nil, ErrClosed
+	}
+	return copyMap(ms.cooldowns), nil
+}
+
+func (ms *MemoryBackingStore) CreateAlias(name, target string) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	if ms.closed {
+		return ErrClosed
+	}
+	if _, ok := ms.aliases[name]; ok {
+		return ErrAlreadyExists
+	}
+	ms.aliases[name] = target
+	return nil
+}
+
+func (ms *MemoryBackingStore) RetrieveAlias(name string) (string, error) {
+	ms.lock.RLock()
+	defer ms.lock.RUnlock()
+	if ms.closed {
+		return "", ErrClosed
+	}
+	target, ok := ms.aliases[name]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return target, nil
+}
+
+func (ms *MemoryBackingStore) DeleteAlias(name string) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	if ms.closed {
+		return ErrClosed
+	}
+	if _, ok := ms.aliases[name]; !ok {
+		return ErrNotFound
+	}
+	delete(ms.aliases, name)
+	return nil
+}
+
+func (ms *MemoryBackingStore) ListAliases() (map[string]string, error) {
+	ms.lock.RLock()
+	defer ms.lock.RUnlock()
+	if ms.closed {
+		return nil, ErrClosed
+	}
+	return copyMap(ms.aliases), nil
+}
+
+func (ms *MemoryBackingStore) CreateAlert(event, template string, minimum int) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	if ms.closed {
+		return ErrClosed
+	}
+	if _, ok := ms.alerts[event]; ok {
+		return ErrAlreadyExists
+	}
+	ms.alerts[event] = memoryAlert{template: template, minimum: minimum}
+	return nil
+}
+
+func (ms *MemoryBackingStore) RetrieveAlert(event string) (string, int, error) {
+	ms.lock.RLock()
+	defer ms.lock.RUnlock()
+	if ms.closed {
+		return "", 0, ErrClosed
+	}
+	alert, ok := ms.alerts[event]
+	if !ok {
+		return "", 0, ErrNotFound
+	}
+	return alert.template, alert.minimum, nil
+}
+
+func (ms *MemoryBackingStore) UpdateAlert(event, template string, minimum int) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	if ms.closed {
+		return ErrClosed
+	}
+	if _, ok := ms.alerts[event]; !ok {
+		return ErrNotFound
+	}
+	ms.alerts[event] = memoryAlert{template: template, minimum: minimum}
+	return nil
+}
+
+func (ms *MemoryBackingStore) DeleteAlert(event string) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	if ms.closed {
+		return ErrClosed
+	}
+	if _, ok := ms.alerts[event]; !ok {
+		return ErrNotFound
+	}
+	delete(ms.alerts, event)
+	return nil
+}
+
+func (ms *MemoryBackingStore) ListAlerts() ([]string, error) {
+	ms.lock.RLock()
+	defer ms.lock.RUnlock()
+	if ms.closed {
+		return nil, ErrClosed
+	}
+	return sortedKeys(ms.alerts), nil
+}
+
+func (ms *MemoryBackingStore) SaveState(name, value string) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	if ms.closed {
+		return ErrClosed
+	}
+	ms.state[name] = value
+	return nil
+}
+
+func (ms *MemoryBackingStore) RetrieveState(name string) (string, error) {
+	ms.lock.RLock()
+	defer ms.lock.RUnlock()
+	if ms.closed {
+		return "", ErrClosed
+	}
+	value, ok := ms.state[name]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+func (ms *MemoryBackingStore) DeleteState(name string) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	if ms.closed {
+		return ErrClosed
+	}
+	if _, ok := ms.state[name]; !ok {
+		return ErrNotFound
+	}
+	delete(ms.state, name)
+	return nil
+}
@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MIGRATIONS holds the schema changes, each file is named <version>_<description>.sql
+// and is applied once, in order of its version.
+//
+//go:embed migrations/*.sql
+var MIGRATIONS embed.FS
+
+var ErrSchemaTooNew = errors.New("the database schema is newer than this version of the bot supports")
+
+type migration struct {
+	version    int
+	name       string
+	statements string
+}
+
+func loadMigrations() ([]migration, error) {
+	files, err := MIGRATIONS.ReadDir("migrations")
+	if err != nil {
+		return nil, err
+	}
+	var result []migration
+	for _, file := range files {
+		name := strings.TrimSuffix(file.Name(), ".sql")
+		prefix, _, _ := strings.Cut(name, "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s does not start with its version", file.Name())
+		}
+		statements, err := MIGRATIONS.ReadFile(path.Join("migrations", file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, migration{
+			version:    version,
+			name:       name,
+			statements: string(statements),
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].version < result[j].version
+	})
+	for i := 1; i < len(result); i++ {
+		if result[i].version == result[i-1].version {
+			return nil, fmt.Errorf("migrations %s and %s have the same version", result[i-1].name, result[i].name)
+		}
+	}
+	return result, nil
+}
+
+// schemaVersion returns the version of the last migration applied to the database, zero for a new database
+func schemaVersion(db *sql.DB) (version int, err error) {
+	_, err = db.Exec("create table if not exists schema_version (version integer primary key, applied text)")
+	if err != nil {
+		return
+	}
+	err = db.QueryRow("select coalesce(max(version), 0) from schema_version").Scan(&version)
+	return
+}
+
+// applyMigration runs a single migration and records it, in one transaction so that a failed migration leaves no trace
+func applyMigration(db *sql.DB, m migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(m.statements)
+	if err != nil {
+		return fmt.Errorf("migration %s failed: %w", m.name, err)
+	}
+	_, err = tx.Exec("insert into schema_version values (?, ?)", m.version, time.Now().Format(time.RFC3339))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// migrate brings the database up to the latest schema, refusing to touch a database
+// whose schema is newer than the migrations this binary knows about.
+func migrate(db *sql.DB) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	return applyMigrations(db, migrations)
+}
+
+// applyMigrations applies the migrations that are newer than the database, migrations must be sorted by version
+func applyMigrations(db *sql.DB, migrations []migration) error {
+	current, err := schemaVersion(db)
+	if err != nil {
+		return err
+	}
+	latest := 0
+	if len(migrations) > 0 {
+		latest = migrations[len(migrations)-1].version
+	}
+	if current > latest {
+		return fmt.Errorf("%w: the database is at version %d, the latest known version is %d", ErrSchemaTooNew, current, latest)
+	}
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		err = applyMigration(db, m)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
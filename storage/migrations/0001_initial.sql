@@ -0,0 +1,7 @@
+create table if not exists counters (name text primary key, value integer, prefix text);
+create table if not exists timers (name text primary key, message text, interval integer, next text);
+create table if not exists mappings (name text primary key, message text);
+create table if not exists cooldowns (name text primary key, global integer, user integer, mod_exempt integer);
+create table if not exists aliases (name text primary key, target text);
+create table if not exists state (name text primary key, value text);
+create table if not exists alerts (event text primary key, template text, minimum integer);
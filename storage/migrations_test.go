@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+// openTestDb opens a bare database in a temporary directory, without running any migrations
+func openTestDb(t *testing.T) (string, *sql.DB) {
+	fname := t.TempDir() + "/data.db"
+	db, err := getSqliteConn(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+	})
+	return fname, db
+}
+
+func exec(t *testing.T, db *sql.DB, statements ...string) {
+	t.Helper()
+	for _, statement := range statements {
+		_, err := db.Exec(statement)
+		if err != nil {
+			t.Fatalf("%s: %v", statement, err)
+		}
+	}
+}
+
+func TestMigrateExistingDatabase(t *testing.T) {
+	fname, db := openTestDb(t)
+	// the tables as they were created before the migrations existed
+	exec(t, db,
+		"create table counters (name text primary key, value integer, prefix text)",
+		"create table timers (name text primary key, message text, interval integer, next text)",
+		"create table mappings (name text primary key, message text)",
+		"insert into counters values ('deaths', 7, 'Deaths')",
+		"insert into mappings values ('lurk', '{user} lurks')",
+	)
+	db.Close()
+
+	store, err := CreateSqliteBacker(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	value, prefix, err := store.RetrieveCounter("deaths")
+	expectNoError(t, "RetrieveCounter", err)
+	if value != 7 || prefix != "Deaths" {
+		t.Errorf("RetrieveCounter = %d, %q, want 7, \"Deaths\"", value, prefix)
+	}
+	message, err := store.RetrieveMapping("lurk")
+	expectNoError(t, "RetrieveMapping", err)
+	if message != "{user} lurks" {
+		t.Errorf("RetrieveMapping = %q, want \"{user} lurks\"", message)
+	}
+	// tables added since then are created
+	expectNoError(t, "CreateAlert", store.CreateAlert("sub", "thanks {user}", 0))
+
+	migrations, err := loadMigrations()
+	expectNoError(t, "loadMigrations", err)
+	version, err := schemaVersion(store.db)
+	expectNoError(t, "schemaVersion", err)
+	if latest := migrations[len(migrations)-1].version; version != latest {
+		t.Errorf("schema version = %d, want %d", version, latest)
+	}
+}
+
+func TestMigrateTwice(t *testing.T) {
+	fname, db := openTestDb(t)
+	db.Close()
+	for i := 0; i < 2; i++ {
+		store, err := CreateSqliteBacker(fname)
+		if err != nil {
+			t.Fatalf("opening the database, attempt %d: %v", i+1, err)
+		}
+		store.Close()
+	}
+}
+
+func TestMigrateNewerSchema(t *testing.T) {
+	_, db := openTestDb(t)
+	exec(t, db,
+		"create table schema_version (version integer primary key, applied text)",
+		"insert into schema_version values (999999, '')",
+	)
+
+	err := migrate(db)
+	if !errors.Is(err, ErrSchemaTooNew) {
+		t.Fatalf("migrate = %v, want %v", err, ErrSchemaTooNew)
+	}
+	var count int
+	err = db.QueryRow("select count(*) from sqlite_master where name = 'counters'").Scan(&count)
+	expectNoError(t, "counting tables", err)
+	if count != 0 {
+		t.Errorf("migrate created tables in a database with a newer schema")
+	}
+}
+
+func TestMigrateFailure(t *testing.T) {
+	_, db := openTestDb(t)
+	migrations := []migration{
+		{version: 1, name: "0001_good", statements: "create table first (id integer)"},
+		{version: 2, name: "0002_bad", statements: "create table second (id integer); insert into missing values (1);"},
+	}
+
+	err := applyMigrations(db, migrations)
+	if err == nil {
+		t.Fatal("applyMigrations of a failing migration returned no error")
+	}
+	version, err := schemaVersion(db)
+	expectNoError(t, "schemaVersion", err)
+	if version != 1 {
+		t.Errorf("schema version = %d after a failed migration, want 1", version)
+	}
+	var count int
+	err = db.QueryRow("select count(*) from schema_version where version = 2").Scan(&count)
+	expectNoError(t, "counting versions", err)
+	if count != 0 {
+		t.Errorf("the failed migration was recorded in schema_version")
+	}
+	err = db.QueryRow("select count(*) from sqlite_master where name = 'second'").Scan(&count)
+	expectNoError(t, "counting tables", err)
+	if count != 0 {
+		t.Errorf("the failed migration's table was kept")
+	}
+}
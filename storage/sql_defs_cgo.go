@@ -1,11 +1,14 @@
 //go:build cgo || arm.7
+
 package storage
 
 import (
 	"database/sql"
+	"fmt"
 	_ "github.com/mattn/go-sqlite3"
 )
 
+// getSqliteConn opens the database in wal mode, waiting up to SQLITE_BUSY_TIMEOUT for locks held by other connections
 func getSqliteConn(fname string) (*sql.DB, error) {
-	return sql.Open("sqlite3", fname)
+	return sql.Open("sqlite3", fmt.Sprintf("%s?_journal_mode=WAL&_busy_timeout=%d", fname, SQLITE_BUSY_TIMEOUT.Milliseconds()))
 }
@@ -1,11 +1,14 @@
 //go:build !cgo
+
 package storage
 
 import (
 	"database/sql"
+	"fmt"
 	_ "modernc.org/sqlite"
 )
 
+// getSqliteConn opens the database in wal mode, waiting up to SQLITE_BUSY_TIMEOUT for locks held by other connections
 func getSqliteConn(fname string) (*sql.DB, error) {
-	return sql.Open("sqlite", fname)
+	return sql.Open("sqlite", fmt.Sprintf("%s?_pragma=journal_mode(WAL)&_pragma=busy_timeout(%d)", fname, SQLITE_BUSY_TIMEOUT.Milliseconds()))
 }
@@ -2,99 +2,171 @@ package storage
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 )
 
+// SQLITE_BUSY_TIMEOUT is how long a statement waits for another connection to release its lock
+const SQLITE_BUSY_TIMEOUT = 5 * time.Second
+
+// SqliteBackingStore keeps a single connection pool open to the database for as long as the store is open,
+// statements are prepared the first time they are used and reused afterwards.
 type SqliteBackingStore struct {
-	fname string
+	fname      string
+	db         *sql.DB
+	lock       sync.Mutex
+	statements map[string]*sql.Stmt
+}
+
+// notFound translates a missing row into ErrNotFound
+func notFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
 }
 
-func (sb SqliteBackingStore) setupTables() error {
-	db, err := getSqliteConn(sb.fname)
+// inserted checks that an insert that ignores conflicts created a row, returning ErrAlreadyExists when it did not
+func inserted(res sql.Result, err error) error {
 	if err != nil {
 		return err
 	}
-	defer db.Close()
-	_, err = db.Exec("create table if not exists counters (name text primary key, value integer, prefix text)")
+	count, err := res.RowsAffected()
 	if err != nil {
 		return err
 	}
-	_, err = db.Exec("create table if not exists timers (name text primary key, message text, interval integer, next text)")
+	if count == 0 {
+		return ErrAlreadyExists
+	}
+	return nil
+}
+
+// changed checks that an update or delete affected a row, returning ErrNotFound when it did not
+func changed(res sql.Result, err error) error {
 	if err != nil {
 		return err
 	}
-	_, err = db.Exec("create table if not exists mappings (name text primary key, message text)")
+	count, err := res.RowsAffected()
 	if err != nil {
 		return err
 	}
+	if count == 0 {
+		return ErrNotFound
+	}
 	return nil
 }
 
+// GetDbConn returns the store's connection pool, it is closed along with the store and must not be closed by the caller
 func (sb *SqliteBackingStore) GetDbConn() (*sql.DB, error) {
-	return getSqliteConn(sb.fname)
+	return sb.db, nil
+}
+
+// prepare returns the prepared statement for the query, preparing it the first time it is used
+func (sb *SqliteBackingStore) prepare(query string) (*sql.Stmt, error) {
+	sb.lock.Lock()
+	defer sb.lock.Unlock()
+	if sb.statements == nil {
+		return nil, fmt.Errorf("%s: %w", sb.fname, ErrClosed)
+	}
+	if stmt, ok := sb.statements[query]; ok {
+		return stmt, nil
+	}
+	stmt, err := sb.db.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	sb.statements[query] = stmt
+	return stmt, nil
+}
+
+// Close releases the prepared statements and closes the database
+func (sb *SqliteBackingStore) Close() error {
+	sb.lock.Lock()
+	defer sb.lock.Unlock()
+	if sb.statements == nil {
+		return nil
+	}
+	for _, stmt := range sb.statements {
+		stmt.Close()
+	}
+	sb.statements = nil
+	return sb.db.Close()
 }
 
 func CreateSqliteBacker(fname string) (*SqliteBackingStore, error) {
-	result := SqliteBackingStore{
-		fname: fname,
+	db, err := getSqliteConn(fname)
+	if err != nil {
+		return nil, err
 	}
-	err := result.setupTables()
-	return &result, err
+	result := &SqliteBackingStore{
+		fname:      fname,
+		db:         db,
+		statements: map[string]*sql.Stmt{},
+	}
+	err = migrate(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return result, nil
 }
 
 func (sb *SqliteBackingStore) CreateCounter(name string, initial int, prefix string) error {
-	db, err := getSqliteConn(sb.fname)
+	stmt, err := sb.prepare("insert into counters values (?, ?, ?) on conflict do nothing")
 	if err != nil {
 		return err
 	}
-	defer db.Close()
-	_, err = db.Exec("insert or ignore into counters values (?, ?, ?)", name, initial, prefix)
-	return err
+	return inserted(stmt.Exec(name, initial, prefix))
 }
 
 func (sb *SqliteBackingStore) RetrieveCounter(name string) (value int, prefix string, err error) {
-	db, err := getSqliteConn(sb.fname)
+	stmt, err := sb.prepare("select value, prefix from counters where name = ?")
 	if err != nil {
 		return
 	}
-	defer db.Close()
-	row := db.QueryRow("select value, prefix from counters where name = ?", name)
+	row := stmt.QueryRow(name)
 	err = row.Err()
 	if err != nil {
 		return
 	}
-	err = row.Scan(&value, &prefix)
+	err = notFound(row.Scan(&value, &prefix))
 	return
 }
 
 func (sb *SqliteBackingStore) UpdateCounter(name string, newValue int) error {
-	db, err := getSqliteConn(sb.fname)
+	stmt, err := sb.prepare("update or replace counters set value = ? where name = ?")
 	if err != nil {
 		return err
 	}
-	defer db.Close()
-	_, err = db.Exec("update or replace counters set value = ? where name = ?", newValue, name)
-	return err
+	return changed(stmt.Exec(newValue, name))
+}
+
+// IncrementCounter atomically adds delta to the counter and returns its new value
+func (sb *SqliteBackingStore) IncrementCounter(name string, delta int) (value int, err error) {
+	stmt, err := sb.prepare("update counters set value = value + ? where name = ? returning value")
+	if err != nil {
+		return
+	}
+	err = notFound(stmt.QueryRow(delta, name).Scan(&value))
+	return
 }
 
 func (sb *SqliteBackingStore) DeleteCounter(name string) error {
-	db, err := getSqliteConn(sb.fname)
+	stmt, err := sb.prepare("delete from counters where name = ?")
 	if err != nil {
 		return err
 	}
-	defer db.Close()
-	_, err = db.Exec("delete from counters where name = ?", name)
-	return err
+	return changed(stmt.Exec(name))
 }
 
 func (sb *SqliteBackingStore) ListCounters() ([]string, error) {
-	db, err := getSqliteConn(sb.fname)
+	stmt, err := sb.prepare("select name from counters")
 	if err != nil {
 		return nil, err
 	}
-	defer db.Close()
-	rows, err := db.Query("select name from counters")
+	rows, err := stmt.Query()
 	if err != nil {
 		return nil, err
 	}
@@ -113,30 +185,27 @@ func (sb *SqliteBackingStore) ListCounters() ([]string, error) {
 }
 
 func (sb *SqliteBackingStore) CreateTimer(name string, message string, interval time.Duration) error {
-	db, err := getSqliteConn(sb.fname)
+	stmt, err := sb.prepare("insert into timers values (?, ?, ?, ?) on conflict do nothing")
 	if err != nil {
 		return err
 	}
-	defer db.Close()
 	next := time.Now().Add(interval).Format(time.RFC3339)
-	_, err = db.Exec("insert or ignore into timers values (?, ?, ?, ?)", name, message, interval.Nanoseconds(), next)
-	return err
+	return inserted(stmt.Exec(name, message, interval.Nanoseconds(), next))
 }
 
 func (sb *SqliteBackingStore) RetrieveTimer(name string) (message string, interval time.Duration, next time.Time, err error) {
-	db, err := getSqliteConn(sb.fname)
+	stmt, err := sb.prepare("select message, interval, next from timers where name = ?")
 	if err != nil {
 		return
 	}
-	defer db.Close()
-	row := db.QueryRow("select message, interval, next from timers where name = ?", name)
+	row := stmt.QueryRow(name)
 	err = row.Err()
 	if err != nil {
 		return
 	}
 	var iint int64
 	var snext string
-	err = row.Scan(&message, &iint, &snext)
+	err = notFound(row.Scan(&message, &iint, &snext))
 	if err != nil {
 		return
 	}
@@ -151,43 +220,28 @@ func (sb *SqliteBackingStore) ResetTimer(name string) error {
 		return err
 	}
 
-	db, err := getSqliteConn(sb.fname)
+	stmt, err := sb.prepare("update or replace timers set next = ? where name = ?")
 	if err != nil {
 		return err
 	}
-	defer db.Close()
 	next := time.Now().Add(intr).Format(time.RFC3339)
-	res, err := db.Exec("update or replace timers set next = ? where name = ?", next, name)
-	if err != nil {
-		return err
-	}
-	cnt, err := res.RowsAffected()
-	if err != nil {
-		return err
-	}
-	if cnt == 0 {
-		return fmt.Errorf("timer reset did not change any rows")
-	}
-	return nil
+	return changed(stmt.Exec(next, name))
 }
 
 func (sb *SqliteBackingStore) DeleteTimer(name string) error {
-	db, err := getSqliteConn(sb.fname)
+	stmt, err := sb.prepare("delete from timers where name = ?")
 	if err != nil {
 		return err
 	}
-	defer db.Close()
-	_, err = db.Exec("delete from timers where name = ?", name)
-	return err
+	return changed(stmt.Exec(name))
 }
 
 func (sb *SqliteBackingStore) ListTimers() (map[string]time.Time, error) {
-	db, err := getSqliteConn(sb.fname)
+	stmt, err := sb.prepare("select name, next from timers order by strftime(\"%s\", next)")
 	if err != nil {
 		return nil, err
 	}
-	defer db.Close()
-	rows, err := db.Query("select name, next from timers order by strftime(\"%s\", next)")
+	rows, err := stmt.Query()
 	if err != nil {
 		return nil, err
 	}
@@ -210,57 +264,49 @@ func (sb *SqliteBackingStore) ListTimers() (map[string]time.Time, error) {
 }
 
 func (sb *SqliteBackingStore) CreateMapping(name, message string) error {
-	db, err := getSqliteConn(sb.fname)
+	stmt, err := sb.prepare("insert into mappings values (?, ?) on conflict do nothing")
 	if err != nil {
 		return err
 	}
-	defer db.Close()
-	_, err = db.Exec("insert or ignore into mappings values (?, ?)", name, message)
-	return err
+	return inserted(stmt.Exec(name, message))
 }
 
 func (sb *SqliteBackingStore) RetrieveMapping(name string) (msg string, err error) {
-	db, err := getSqliteConn(sb.fname)
+	stmt, err := sb.prepare("select message from mappings where name = ?")
 	if err != nil {
 		return
 	}
-	defer db.Close()
-	row := db.QueryRow("select message from mappings where name = ?", name)
+	row := stmt.QueryRow(name)
 	err = row.Err()
 	if err != nil {
 		return
 	}
-	err = row.Scan(&msg)
+	err = notFound(row.Scan(&msg))
 	return
 }
 
 func (sb *SqliteBackingStore) UpdateMapping(name, newMessage string) error {
-	db, err := getSqliteConn(sb.fname)
+	stmt, err := sb.prepare("update or replace mappings set message = ? where name = ?")
 	if err != nil {
 		return err
 	}
-	defer db.Close()
-	_, err = db.Exec("update or replace mappings set message = ? where name = ?", newMessage, name)
-	return err
+	return changed(stmt.Exec(newMessage, name))
 }
 
 func (sb *SqliteBackingStore) DeleteMapping(name string) error {
-	db, err := getSqliteConn(sb.fname)
+	stmt, err := sb.prepare("delete from mappings where name = ?")
 	if err != nil {
 		return err
 	}
-	defer db.Close()
-	_, err = db.Exec("delete from mappings where name = ?", name)
-	return err
+	return changed(stmt.Exec(name))
 }
 
 func (sb *SqliteBackingStore) ListMappings() (result map[string]string, err error) {
-	db, err := getSqliteConn(sb.fname)
+	stmt, err := sb.prepare("select * from mappings order by name")
 	if err != nil {
 		return
 	}
-	defer db.Close()
-	rows, err := db.Query("select * from mappings order by name")
+	rows, err := stmt.Query()
 	if err != nil {
 		return
 	}
@@ -277,3 +323,211 @@ func (sb *SqliteBackingStore) ListMappings() (result map[string]string, err erro
 	err = rows.Err()
 	return
 }
+
+func (sb *SqliteBackingStore) SetCooldown(name string, cooldown Cooldown) error {
+	stmt, err := sb.prepare("insert or replace into cooldowns values (?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	_, err = stmt.Exec(name, cooldown.Global.Nanoseconds(), cooldown.User.Nanoseconds(), cooldown.ModeratorExempt)
+	return err
+}
+
+func (sb *SqliteBackingStore) RetrieveCooldown(name string) (cooldown Cooldown, err error) {
+	stmt, err := sb.prepare("select global, user, mod_exempt from cooldowns where name = ?")
+	if err != nil {
+		return
+	}
+	row := stmt.QueryRow(name)
+	err = row.Err()
+	if err != nil {
+		return
+	}
+	var global, user int64
+	err = notFound(row.Scan(&global, &user, &cooldown.ModeratorExempt))
+	cooldown.Global = time.Duration(global)
+	cooldown.User = time.Duration(user)
+	return
+}
+
+func (sb *SqliteBackingStore) DeleteCooldown(name string) error {
+	stmt, err := sb.prepare("delete from cooldowns where name = ?")
+	if err != nil {
+		return err
+	}
+	return changed(stmt.Exec(name))
+}
+
+func (sb *SqliteBackingStore) ListCooldowns() (result map[string]Cooldown, err error) {
+	stmt, err := sb.prepare("select name, global, user, mod_exempt from cooldowns order by name")
+	if err != nil {
+		return
+	}
+	rows, err := stmt.Query()
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	result = map[string]Cooldown{}
+	var tname string
+	var global, user int64
+	var exempt bool
+	for rows.Next() {
+		err = rows.Scan(&tname, &global, &user, &exempt)
+		if err != nil {
+			return
+		}
+		result[tname] = Cooldown{
+			Global:          time.Duration(global),
+			User:            time.Duration(user),
+			ModeratorExempt: exempt,
+		}
+	}
+	err = rows.Err()
+	return
+}
+
+func (sb *SqliteBackingStore) CreateAlias(name, target string) error {
+	stmt, err := sb.prepare("insert into aliases values (?, ?) on conflict do nothing")
+	if err != nil {
+		return err
+	}
+	return inserted(stmt.Exec(name, target))
+}
+
+func (sb *SqliteBackingStore) RetrieveAlias(name string) (target string, err error) {
+	stmt, err := sb.prepare("select target from aliases where name = ?")
+	if err != nil {
+		return
+	}
+	row := stmt.QueryRow(name)
+	err = row.Err()
+	if err != nil {
+		return
+	}
+	err = notFound(row.Scan(&target))
+	return
+}
+
+func (sb *SqliteBackingStore) DeleteAlias(name string) error {
+	stmt, err := sb.prepare("delete from aliases where name = ?")
+	if err != nil {
+		return err
+	}
+	return changed(stmt.Exec(name))
+}
+
+func (sb *SqliteBackingStore) ListAliases() (result map[string]string, err error) {
+	stmt, err := sb.prepare("select name, target from aliases order by name")
+	if err != nil {
+		return
+	}
+	rows, err := stmt.Query()
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	result = map[string]string{}
+	var tname, ttarget string
+	for rows.Next() {
+		err = rows.Scan(&tname, &ttarget)
+		if err != nil {
+			return
+		}
+		result[tname] = ttarget
+	}
+	err = rows.Err()
+	return
+}
+
+func (sb *SqliteBackingStore) SaveState(name, value string) error {
+	stmt, err := sb.prepare("insert or replace into state values (?, ?)")
+	if err != nil {
+		return err
+	}
+	_, err = stmt.Exec(name, value)
+	return err
+}
+
+func (sb *SqliteBackingStore) RetrieveState(name string) (value string, err error) {
+	stmt, err := sb.prepare("select value from state where name = ?")
+	if err != nil {
+		return
+	}
+	row := stmt.QueryRow(name)
+	err = row.Err()
+	if err != nil {
+		return
+	}
+	err = notFound(row.Scan(&value))
+	return
+}
+
+func (sb *SqliteBackingStore) DeleteState(name string) error {
+	stmt, err := sb.prepare("delete from state where name = ?")
+	if err != nil {
+		return err
+	}
+	return changed(stmt.Exec(name))
+}
+
+func (sb *SqliteBackingStore) CreateAlert(event, template string, minimum int) error {
+	stmt, err := sb.prepare("insert into alerts values (?, ?, ?) on conflict do nothing")
+	if err != nil {
+		return err
+	}
+	return inserted(stmt.Exec(event, template, minimum))
+}
+
+func (sb *SqliteBackingStore) RetrieveAlert(event string) (template string, minimum int, err error) {
+	stmt, err := sb.prepare("select template, minimum from alerts where event = ?")
+	if err != nil {
+		return
+	}
+	row := stmt.QueryRow(event)
+	err = row.Err()
+	if err != nil {
+		return
+	}
+	err = notFound(row.Scan(&template, &minimum))
+	return
+}
+
+func (sb *SqliteBackingStore) UpdateAlert(event, template string, minimum int) error {
+	stmt, err := sb.prepare("update or replace alerts set template = ?, minimum = ? where event = ?")
+	if err != nil {
+		return err
+	}
+	return changed(stmt.Exec(template, minimum, event))
+}
+
+func (sb *SqliteBackingStore) DeleteAlert(event string) error {
+	stmt, err := sb.prepare("delete from alerts where event = ?")
+	if err != nil {
+		return err
+	}
+	return changed(stmt.Exec(event))
+}
+
+func (sb *SqliteBackingStore) ListAlerts() ([]string, error) {
+	stmt, err := sb.prepare("select event from alerts order by event")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := stmt.Query()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var result []string
+	var temp string
+	for rows.Next() {
+		err = rows.Scan(&temp)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, temp)
+	}
+	err = rows.Err()
+	return result, err
+}
@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+const BENCH_TIMERS = 5
+
+func createBenchStore(b *testing.B) *SqliteBackingStore {
+	store, err := CreateSqliteBacker(b.TempDir() + "/bench.db")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() {
+		store.Close()
+	})
+	err = store.CreateCounter("deaths", 0, "Deaths")
+	if err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < BENCH_TIMERS; i++ {
+		err = store.CreateTimer(fmt.Sprintf("timer%d", i), "message", time.Minute)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	return store
+}
+
+// reopenRetrieveCounter retrieves a counter the way the store did before it kept its connection open
+func reopenRetrieveCounter(fname, name string) (value int, prefix string, err error) {
+	db, err := getSqliteConn(fname)
+	if err != nil {
+		return
+	}
+	defer db.Close()
+	err = db.QueryRow("select value, prefix from counters where name = ?", name).Scan(&value, &prefix)
+	return
+}
+
+// reopenTimers lists and retrieves every timer, as HandleTimers does each second,
+// the way the store did before it kept its connection open
+func reopenTimers(fname string) error {
+	db, err := getSqliteConn(fname)
+	if err != nil {
+		return err
+	}
+	rows, err := db.Query("select name from timers")
+	if err != nil {
+		db.Close()
+		return err
+	}
+	var names []string
+	for rows.Next() {
+		var name string
+		err = rows.Scan(&name)
+		if err != nil {
+			rows.Close()
+			db.Close()
+			return err
+		}
+		names = append(names, name)
+	}
+	rows.Close()
+	db.Close()
+
+	for _, name := range names {
+		db, err := getSqliteConn(fname)
+		if err != nil {
+			return err
+		}
+		var message, next string
+		var interval int64
+		err = db.QueryRow("select message, interval, next from timers where name = ?", name).Scan(&message, &interval, &next)
+		db.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func BenchmarkRetrieveCounter(b *testing.B) {
+	store := createBenchStore(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _, err := store.RetrieveCounter("deaths")
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRetrieveCounterReopen(b *testing.B) {
+	store := createBenchStore(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _, err := reopenRetrieveCounter(store.fname, "deaths")
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkTimers(b *testing.B) {
+	store := createBenchStore(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		timers, err := store.ListTimers()
+		if err != nil {
+			b.Fatal(err)
+		}
+		for name := range timers {
+			_, _, _, err = store.RetrieveTimer(name)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkTimersReopen(b *testing.B) {
+	store := createBenchStore(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := reopenTimers(store.fname)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -2,17 +2,37 @@ package storage
 
 import (
 	"database/sql"
+	"errors"
 	"time"
 )
 
+var (
+	// ErrNotFound is returned when the item being retrieved, updated or deleted does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrAlreadyExists is returned when creating an item whose name is already taken
+	ErrAlreadyExists = errors.New("already exists")
+	// ErrClosed is returned by every call made after the store has been closed
+	ErrClosed = errors.New("the store has been closed")
+)
+
+// Cooldown describes how often a command may be used, both by the channel as a whole
+// and by any single user
+type Cooldown struct {
+	Global          time.Duration
+	User            time.Duration
+	ModeratorExempt bool
+}
+
 type StorageBacking interface {
 	// General
 	GetDbConn() (*sql.DB, error)
+	Close() error
 
 	// Counters
 	CreateCounter(name string, initial int, prefix string) error
 	RetrieveCounter(name string) (int, string, error)
 	UpdateCounter(name string, newValue int) error
+	IncrementCounter(name string, delta int) (int, error)
 	DeleteCounter(name string) error
 	ListCounters() ([]string, error)
 
@@ -29,4 +49,28 @@ type StorageBacking interface {
 	UpdateMapping(name, newMessage string) error
 	DeleteMapping(name string) error
 	ListMappings() (map[string]string, error)
+
+	// Cooldowns
+	SetCooldown(name string, cooldown Cooldown) error
+	RetrieveCooldown(name string) (Cooldown, error)
+	DeleteCooldown(name string) error
+	ListCooldowns() (map[string]Cooldown, error)
+
+	// Aliases
+	CreateAlias(name, target string) error
+	RetrieveAlias(name string) (string, error)
+	DeleteAlias(name string) error
+	ListAliases() (map[string]string, error)
+
+	// Alerts
+	CreateAlert(event, template string, minimum int) error
+	RetrieveAlert(event string) (string, int, error)
+	UpdateAlert(event, template string, minimum int) error
+	DeleteAlert(event string) error
+	ListAlerts() ([]string, error)
+
+	// State is used to persist arbitrary values across restarts
+	SaveState(name, value string) error
+	RetrieveState(name string) (string, error)
+	DeleteState(name string) error
 }
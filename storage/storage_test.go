@@ -0,0 +1,263 @@
+package storage
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// backers creates each implementation of StorageBacking, every test runs against all of them
+// so that they are known to behave the same
+var backers = map[string]func(t *testing.T) StorageBacking{
+	"memory": func(t *testing.T) StorageBacking {
+		return CreateMemoryBacker()
+	},
+	"sqlite": func(t *testing.T) StorageBacking {
+		store, err := CreateSqliteBacker(t.TempDir() + "/x.db")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store
+	},
+}
+
+func forEachBacker(t *testing.T, test func(t *testing.T, store StorageBacking)) {
+	for name, create := range backers {
+		t.Run(name, func(t *testing.T) {
+			store := create(t)
+			defer store.Close()
+			test(t, store)
+		})
+	}
+}
+
+func expectError(t *testing.T, operation string, err, want error) {
+	t.Helper()
+	if !errors.Is(err, want) {
+		t.Errorf("%s returned %v, want %v", operation, err, want)
+	}
+}
+
+func expectNoError(t *testing.T, operation string, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%s returned %v", operation, err)
+	}
+}
+
+func TestCounters(t *testing.T) {
+	forEachBacker(t, func(t *testing.T, store StorageBacking) {
+		expectNoError(t, "CreateCounter", store.CreateCounter("deaths", 3, "Deaths"))
+		expectError(t, "CreateCounter of an existing counter", store.CreateCounter("deaths", 0, "Other"), ErrAlreadyExists)
+
+		value, prefix, err := store.RetrieveCounter("deaths")
+		expectNoError(t, "RetrieveCounter", err)
+		if value != 3 || prefix != "Deaths" {
+			t.Errorf("RetrieveCounter = %d, %q, want 3, \"Deaths\"", value, prefix)
+		}
+
+		value, err = store.IncrementCounter("deaths", 2)
+		expectNoError(t, "IncrementCounter", err)
+		if value != 5 {
+			t.Errorf("IncrementCounter = %d, want 5", value)
+		}
+		value, err = store.IncrementCounter("deaths", -7)
+		expectNoError(t, "IncrementCounter", err)
+		if value != -2 {
+			t.Errorf("IncrementCounter = %d, want -2", value)
+		}
+
+		expectNoError(t, "UpdateCounter", store.UpdateCounter("deaths", 10))
+		value, _, err = store.RetrieveCounter("deaths")
+		expectNoError(t, "RetrieveCounter", err)
+		if value != 10 {
+			t.Errorf("RetrieveCounter after UpdateCounter = %d, want 10", value)
+		}
+
+		expectNoError(t, "CreateCounter", store.CreateCounter("wins", 0, "Wins"))
+		names, err := store.ListCounters()
+		expectNoError(t, "ListCounters", err)
+		sort.Strings(names)
+		if !reflect.DeepEqual(names, []string{"deaths", "wins"}) {
+			t.Errorf("ListCounters = %v, want [deaths wins]", names)
+		}
+
+		expectNoError(t, "DeleteCounter", store.DeleteCounter("deaths"))
+		_, _, err = store.RetrieveCounter("deaths")
+		expectError(t, "RetrieveCounter of a missing counter", err, ErrNotFound)
+		expectError(t, "UpdateCounter of a missing counter", store.UpdateCounter("deaths", 1), ErrNotFound)
+		_, err = store.IncrementCounter("deaths", 1)
+		expectError(t, "IncrementCounter of a missing counter", err, ErrNotFound)
+		expectError(t, "DeleteCounter of a missing counter", store.DeleteCounter("deaths"), ErrNotFound)
+	})
+}
+
+func TestTimers(t *testing.T) {
+	forEachBacker(t, func(t *testing.T, store StorageBacking) {
+		before := time.Now().Truncate(time.Second)
+		expectNoError(t, "CreateTimer", store.CreateTimer("discord", "join the discord", time.Minute))
+		expectError(t, "CreateTimer of an existing timer", store.CreateTimer("discord", "other", time.Hour), ErrAlreadyExists)
+
+		message, interval, next, err := store.RetrieveTimer("discord")
+		expectNoError(t, "RetrieveTimer", err)
+		if message != "join the discord" || interval != time.Minute {
+			t.Errorf("RetrieveTimer = %q, %s, want \"join the discord\", 1m", message, interval)
+		}
+		if next.Before(before.Add(time.Minute)) || next.After(time.Now().Add(time.Minute)) {
+			t.Errorf("RetrieveTimer next = %s, want a minute from now", next)
+		}
+
+		timers, err := store.ListTimers()
+		expectNoError(t, "ListTimers", err)
+		if len(timers) != 1 || !timers["discord"].Equal(next) {
+			t.Errorf("ListTimers = %v, want discord at %s", timers, next)
+		}
+
+		expectNoError(t, "ResetTimer", store.ResetTimer("discord"))
+		expectNoError(t, "DeleteTimer", store.DeleteTimer("discord"))
+		_, _, _, err = store.RetrieveTimer("discord")
+		expectError(t, "RetrieveTimer of a missing timer", err, ErrNotFound)
+		expectError(t, "ResetTimer of a missing timer", store.ResetTimer("discord"), ErrNotFound)
+		expectError(t, "DeleteTimer of a missing timer", store.DeleteTimer("discord"), ErrNotFound)
+	})
+}
+
+func TestMappings(t *testing.T) {
+	forEachBacker(t, func(t *testing.T, store StorageBacking) {
+		expectNoError(t, "CreateMapping", store.CreateMapping("lurk", "{user} lurks"))
+		expectError(t, "CreateMapping of an existing mapping", store.CreateMapping("lurk", "other"), ErrAlreadyExists)
+		expectNoError(t, "UpdateMapping", store.UpdateMapping("lurk", "{user} hides"))
+
+		message, err := store.RetrieveMapping("lurk")
+		expectNoError(t, "RetrieveMapping", err)
+		if message != "{user} hides" {
+			t.Errorf("RetrieveMapping = %q, want \"{user} hides\"", message)
+		}
+
+		mappings, err := store.ListMappings()
+		expectNoError(t, "ListMappings", err)
+		if !reflect.DeepEqual(mappings, map[string]string{"lurk": "{user} hides"}) {
+			t.Errorf("ListMappings = %v", mappings)
+		}
+
+		expectNoError(t, "DeleteMapping", store.DeleteMapping("lurk"))
+		_, err = store.RetrieveMapping("lurk")
+		expectError(t, "RetrieveMapping of a missing mapping", err, ErrNotFound)
+		expectError(t, "UpdateMapping of a missing mapping", store.UpdateMapping("lurk", "x"), ErrNotFound)
+		expectError(t, "DeleteMapping of a missing mapping", store.DeleteMapping("lurk"), ErrNotFound)
+	})
+}
+
+func TestCooldowns(t *testing.T) {
+	forEachBacker(t, func(t *testing.T, store StorageBacking) {
+		first := Cooldown{Global: time.Minute}
+		second := Cooldown{Global: 30 * time.Second, User: 5 * time.Minute, ModeratorExempt: true}
+		expectNoError(t, "SetCooldown", store.SetCooldown("lurk", first))
+		expectNoError(t, "SetCooldown of an existing cooldown", store.SetCooldown("lurk", second))
+
+		cooldown, err := store.RetrieveCooldown("lurk")
+		expectNoError(t, "RetrieveCooldown", err)
+		if cooldown != second {
+			t.Errorf("RetrieveCooldown = %+v, want %+v", cooldown, second)
+		}
+
+		cooldowns, err := store.ListCooldowns()
+		expectNoError(t, "ListCooldowns", err)
+		if !reflect.DeepEqual(cooldowns, map[string]Cooldown{"lurk": second}) {
+			t.Errorf("ListCooldowns = %v", cooldowns)
+		}
+
+		expectNoError(t, "DeleteCooldown", store.DeleteCooldown("lurk"))
+		_, err = store.RetrieveCooldown("lurk")
+		expectError(t, "RetrieveCooldown of a missing cooldown", err, ErrNotFound)
+		expectError(t, "DeleteCooldown of a missing cooldown", store.DeleteCooldown("lurk"), ErrNotFound)
+	})
+}
+
+func TestAliases(t *testing.T) {
+	forEachBacker(t, func(t *testing.T, store StorageBacking) {
+		expectNoError(t, "CreateAlias", store.CreateAlias("dc", "discord"))
+		expectError(t, "CreateAlias of an existing alias", store.CreateAlias("dc", "other"), ErrAlreadyExists)
+
+		target, err := store.RetrieveAlias("dc")
+		expectNoError(t, "RetrieveAlias", err)
+		if target != "discord" {
+			t.Errorf("RetrieveAlias = %q, want \"discord\"", target)
+		}
+
+		aliases, err := store.ListAliases()
+		expectNoError(t, "ListAliases", err)
+		if !reflect.DeepEqual(aliases, map[string]string{"dc": "discord"}) {
+			t.Errorf("ListAliases = %v", aliases)
+		}
+
+		expectNoError(t, "DeleteAlias", store.DeleteAlias("dc"))
+		_, err = store.RetrieveAlias("dc")
+		expectError(t, "RetrieveAlias of a missing alias", err, ErrNotFound)
+		expectError(t, "DeleteAlias of a missing alias", store.DeleteAlias("dc"), ErrNotFound)
+	})
+}
+
+func TestAlerts(t *testing.T) {
+	forEachBacker(t, func(t *testing.T, store StorageBacking) {
+		expectNoError(t, "CreateAlert", store.CreateAlert("sub", "thanks {user}", 0))
+		expectNoError(t, "CreateAlert", store.CreateAlert("raid", "welcome {user}", 5))
+		expectError(t, "CreateAlert of an existing alert", store.CreateAlert("sub", "other", 1), ErrAlreadyExists)
+		expectNoError(t, "UpdateAlert", store.UpdateAlert("raid", "hello raiders", 10))
+
+		template, minimum, err := store.RetrieveAlert("raid")
+		expectNoError(t, "RetrieveAlert", err)
+		if template != "hello raiders" || minimum != 10 {
+			t.Errorf("RetrieveAlert = %q, %d, want \"hello raiders\", 10", template, minimum)
+		}
+
+		events, err := store.ListAlerts()
+		expectNoError(t, "ListAlerts", err)
+		if !reflect.DeepEqual(events, []string{"raid", "sub"}) {
+			t.Errorf("ListAlerts = %v, want [raid sub]", events)
+		}
+
+		expectNoError(t, "DeleteAlert", store.DeleteAlert("raid"))
+		_, _, err = store.RetrieveAlert("raid")
+		expectError(t, "RetrieveAlert of a missing alert", err, ErrNotFound)
+		expectError(t, "UpdateAlert of a missing alert", store.UpdateAlert("raid", "x", 0), ErrNotFound)
+		expectError(t, "DeleteAlert of a missing alert", store.DeleteAlert("raid"), ErrNotFound)
+	})
+}
+
+func TestState(t *testing.T) {
+	forEachBacker(t, func(t *testing.T, store StorageBacking) {
+		expectNoError(t, "SaveState", store.SaveState("queue", "[]"))
+		expectNoError(t, "SaveState of existing state", store.SaveState("queue", "[1]"))
+
+		value, err := store.RetrieveState("queue")
+		expectNoError(t, "RetrieveState", err)
+		if value != "[1]" {
+			t.Errorf("RetrieveState = %q, want \"[1]\"", value)
+		}
+
+		expectNoError(t, "DeleteState", store.DeleteState("queue"))
+		_, err = store.RetrieveState("queue")
+		expectError(t, "RetrieveState of missing state", err, ErrNotFound)
+		expectError(t, "DeleteState of missing state", store.DeleteState("queue"), ErrNotFound)
+	})
+}
+
+func TestClose(t *testing.T) {
+	forEachBacker(t, func(t *testing.T, store StorageBacking) {
+		expectNoError(t, "CreateCounter", store.CreateCounter("deaths", 0, "Deaths"))
+		expectNoError(t, "Close", store.Close())
+		expectNoError(t, "Close of a closed store", store.Close())
+
+		expectError(t, "CreateCounter after Close", store.CreateCounter("wins", 0, "Wins"), ErrClosed)
+		_, _, err := store.RetrieveCounter("deaths")
+		expectError(t, "RetrieveCounter after Close", err, ErrClosed)
+		_, err = store.IncrementCounter("deaths", 1)
+		expectError(t, "IncrementCounter after Close", err, ErrClosed)
+		_, err = store.ListTimers()
+		expectError(t, "ListTimers after Close", err, ErrClosed)
+		expectError(t, "SaveState after Close", store.SaveState("queue", "[]"), ErrClosed)
+	})
+}
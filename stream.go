@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aaron-jencks/gitchbot/helix"
+)
+
+var TITLE_ARGS = ArgSchema{
+	{Name: "title", Type: ARG_TEXT, Optional: true, MinLen: 1, MaxLen: 140},
+}
+
+var GAME_ARGS = ArgSchema{
+	{Name: "game", Type: ARG_TEXT, Optional: true},
+}
+
+var SHOUTOUT_ARGS = ArgSchema{
+	{Name: "user", Type: ARG_USER},
+}
+
+// formatUptime formats how long a stream has been live, e.g. "2h 5m"
+func formatUptime(uptime time.Duration) string {
+	hours := int(uptime.Hours())
+	minutes := int(uptime.Minutes()) % 60
+	if hours == 0 {
+		return fmt.Sprintf("%dm", minutes)
+	}
+	return fmt.Sprintf("%dh %dm", hours, minutes)
+}
+
+// replyHelixError tells the chatter why their command failed and returns the error so that it is logged,
+// along with the error from replying if that failed as well
+func replyHelixError(client Bot, msg ReducedMessage, err error) error {
+	if err == nil {
+		return nil
+	}
+	var failure *helix.Error
+	var reply string
+	switch {
+	case errors.Is(err, helix.ErrMissingScope):
+		reply = "the bot's token is missing the scope needed for that"
+	case errors.Is(err, helix.ErrUserNotFound):
+		reply = "twitch could not find the channel"
+	case errors.As(err, &failure) && failure.Status == http.StatusUnauthorized:
+		reply = "twitch rejected the bot's token"
+	case errors.As(err, &failure) && failure.Status == http.StatusForbidden:
+		reply = "the bot is not allowed to do that"
+	case errors.As(err, &failure) && failure.Status == http.StatusTooManyRequests:
+		reply = "the bot is sending twitch too many requests, try again later"
+	case errors.As(err, &failure) && failure.Status < http.StatusInternalServerError:
+		reply = "twitch refused the request"
+		if failure.Message != "" {
+			reply += ": " + failure.Message
+		}
+	default:
+		reply = "twitch could not be reached, try again later"
+	}
+	sayErr := client.Say(msg.Channel, fmt.Sprintf("@%s %s", msg.User.DisplayName, reply))
+	if sayErr != nil {
+		return fmt.Errorf("%w (replying failed as well: %v)", err, sayErr)
+	}
+	return err
+}
+
+// withHelix creates an ArgsHandler that is given the bot's helix client,
+// replying with a sensible message when the api cannot be used.
+func withHelix(handler func(ctx context.Context, client Bot, api *helix.Client, msg ReducedMessage, args Args) error) ArgsHandler {
+	return func(ctx context.Context, client Bot, msg ReducedMessage, command Command, args Args) error {
+		api := client.Helix()
+		if api == nil {
+			return client.Say(msg.Channel, fmt.Sprintf("@%s the twitch api has not been set up", msg.User.DisplayName))
+		}
+		return replyHelixError(client, msg, handler(ctx, client, api, msg, args))
+	}
+}
+
+// withBroadcaster creates an ArgsHandler that is given the bot's helix client and the id of the channel's broadcaster
+func withBroadcaster(handler func(ctx context.Context, client Bot, api *helix.Client, broadcasterID string, msg ReducedMessage, args Args) error) ArgsHandler {
+	return withHelix(func(ctx context.Context, client Bot, api *helix.Client, msg ReducedMessage, args Args) error {
+		broadcaster, err := api.GetUser(ctx, normalizeChannel(msg.Channel))
+		if err != nil {
+			return err
+		}
+		return handler(ctx, client, api, broadcaster.ID, msg, args)
+	})
+}
+
+// CreateStreamHandlers registers the !title, !game, !uptime and !so commands in every channel
+func CreateStreamHandlers(b Bot) {
+	b.RegisterHandler(ALL_CHANNELS, HandlerInfo{
+		Name:        "title",
+		Description: "shows or changes the stream title",
+		Usage:       TITLE_ARGS.Usage("title"),
+		Role:        ROLE_MODERATOR,
+	}, WithArgs(TITLE_ARGS, withBroadcaster(func(ctx context.Context, client Bot, api *helix.Client, broadcasterID string, msg ReducedMessage, args Args) error {
+		if !args.Has("title") {
+			channel, err := api.GetChannel(ctx, broadcasterID)
+			if err != nil {
+				return err
+			}
+			return client.Say(msg.Channel, fmt.Sprintf("@%s the title is: %s", msg.User.DisplayName, channel.Title))
+		}
+		err := api.ModifyChannel(ctx, broadcasterID, helix.ChannelUpdate{Title: args.String("title")})
+		if err != nil {
+			return err
+		}
+		return client.Say(msg.Channel, fmt.Sprintf("@%s the title is now: %s", msg.User.DisplayName, args.String("title")))
+	})))
+
+	b.RegisterHandler(ALL_CHANNELS, HandlerInfo{
+		Name:        "game",
+		Description: "shows or changes the stream category",
+		Usage:       GAME_ARGS.Usage("game"),
+		Role:        ROLE_MODERATOR,
+	}, WithArgs(GAME_ARGS, withBroadcaster(func(ctx context.Context, client Bot, api *helix.Client, broadcasterID string, msg ReducedMessage, args Args) error {
+		if !args.Has("game") {
+			channel, err := api.GetChannel(ctx, broadcasterID)
+			if err != nil {
+				return err
+			}
+			return client.Say(msg.Channel, fmt.Sprintf("@%s the category is %s", msg.User.DisplayName, channel.GameName))
+		}
+		game, err := api.GetGame(ctx, args.String("game"))
+		if errors.Is(err, helix.ErrGameNotFound) {
+			return client.Say(msg.Channel, fmt.Sprintf("@%s there is no category called %s", msg.User.DisplayName, args.String("game")))
+		}
+		if err != nil {
+			return err
+		}
+		err = api.ModifyChannel(ctx, broadcasterID, helix.ChannelUpdate{GameID: game.ID})
+		if err != nil {
+			return err
+		}
+		return client.Say(msg.Channel, fmt.Sprintf("@%s the category is now %s", msg.User.DisplayName, game.Name))
+	})))
+
+	b.RegisterHandler(ALL_CHANNELS, HandlerInfo{
+		Name:        "uptime",
+		Description: "shows how long the stream has been live",
+		Role:        ROLE_MODERATOR,
+	}, WithArgs(nil, withHelix(func(ctx context.Context, client Bot, api *helix.Client, msg ReducedMessage, args Args) error {
+		stream, err := api.GetStream(ctx, normalizeChannel(msg.Channel))
+		if errors.Is(err, helix.ErrStreamOffline) {
+			return client.Say(msg.Channel, fmt.Sprintf("@%s the stream is offline", msg.User.DisplayName))
+		}
+		if err != nil {
+			return err
+		}
+		return client.Say(msg.Channel, fmt.Sprintf("@%s the stream has been live for %s", msg.User.DisplayName, formatUptime(time.Since(stream.StartedAt))))
+	})))
+
+	b.RegisterHandler(ALL_CHANNELS, HandlerInfo{
+		Name:        "so",
+		Description: "gives another streamer a shoutout",
+		Usage:       SHOUTOUT_ARGS.Usage("so"),
+		Role:        ROLE_MODERATOR,
+	}, WithArgs(SHOUTOUT_ARGS, withHelix(func(ctx context.Context, client Bot, api *helix.Client, msg ReducedMessage, args Args) error {
+		user, err := api.GetUser(ctx, args.String("user"))
+		if errors.Is(err, helix.ErrUserNotFound) {
+			return client.Say(msg.Channel, fmt.Sprintf("@%s there is no user called %s", msg.User.DisplayName, args.String("user")))
+		}
+		if err != nil {
+			return err
+		}
+		channel, err := api.GetChannel(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		shoutout := fmt.Sprintf("Go check out %s at https://twitch.tv/%s", user.DisplayName, user.Login)
+		if channel.GameName != "" {
+			shoutout += fmt.Sprintf(", they were last playing %s", channel.GameName)
+		}
+		return client.Say(msg.Channel, shoutout)
+	})))
+}
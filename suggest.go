@@ -0,0 +1,110 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	SUGGESTION_CHANNEL_COOLDOWN = 30 * time.Second
+	SUGGESTION_USER_COOLDOWN    = 2 * time.Minute
+	SUGGESTION_MAX_DISTANCE     = 2
+	SUGGESTION_MIN_LENGTH       = 3
+)
+
+// editDistance computes the levenshtein distance between two strings
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for bi := range previous {
+		previous[bi] = bi
+	}
+	for ai := 1; ai <= len(ra); ai++ {
+		current[0] = ai
+		for bi := 1; bi <= len(rb); bi++ {
+			cost := 1
+			if ra[ai-1] == rb[bi-1] {
+				cost = 0
+			}
+			current[bi] = min3(previous[bi]+1, current[bi-1]+1, previous[bi-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// closestCommand finds the candidate closest to name, short names must be closer to match
+// so that every two letter typo doesn't suggest something.
+func closestCommand(name string, candidates []string) (string, bool) {
+	if len([]rune(name)) < SUGGESTION_MIN_LENGTH {
+		return "", false
+	}
+	maxDistance := len([]rune(name)) / 3
+	if maxDistance < 1 {
+		maxDistance = 1
+	} else if maxDistance > SUGGESTION_MAX_DISTANCE {
+		maxDistance = SUGGESTION_MAX_DISTANCE
+	}
+	best := ""
+	bestDistance := maxDistance + 1
+	for _, candidate := range candidates {
+		distance := editDistance(name, candidate)
+		if distance < bestDistance {
+			best = candidate
+			bestDistance = distance
+		}
+	}
+	return best, best != ""
+}
+
+// suggestionLimiter prevents unknown commands being used to make the bot spam suggestions
+type suggestionLimiter struct {
+	lock     sync.Mutex
+	enabled  bool
+	channels map[string]time.Time
+	users    map[string]time.Time
+}
+
+func createSuggestionLimiter() *suggestionLimiter {
+	return &suggestionLimiter{
+		channels: map[string]time.Time{},
+		users:    map[string]time.Time{},
+	}
+}
+
+func (sl *suggestionLimiter) setEnabled(enabled bool) {
+	sl.lock.Lock()
+	defer sl.lock.Unlock()
+	sl.enabled = enabled
+}
+
+// allow records a suggestion for the user if neither the channel nor the user have had one recently
+func (sl *suggestionLimiter) allow(channel, userID string) bool {
+	sl.lock.Lock()
+	defer sl.lock.Unlock()
+	if !sl.enabled {
+		return false
+	}
+	now := time.Now()
+	userKey := channel + "\x00" + userID
+	if last, ok := sl.channels[channel]; ok && now.Sub(last) < SUGGESTION_CHANNEL_COOLDOWN {
+		return false
+	}
+	if last, ok := sl.users[userKey]; ok && now.Sub(last) < SUGGESTION_USER_COOLDOWN {
+		return false
+	}
+	sl.channels[channel] = now
+	sl.users[userKey] = now
+	return true
+}
@@ -1,35 +1,69 @@
 package main
 
 import (
+	"errors"
 	"log"
 	"sync"
 	"time"
+
+	"github.com/aaron-jencks/gitchbot/storage"
 )
 
-func CreateTimer(b Bot, name, message string, interval time.Duration) error {
-	log.Printf("created timer for %s\n", name)
-	return b.Storage().CreateTimer(name, message, interval)
+// CreateTimer creates a timer, an existing timer with the same name is kept
+func CreateTimer(b Bot, channel, name, message string, interval time.Duration) error {
+	err := b.Storage(channel).CreateTimer(name, message, interval)
+	if errors.Is(err, storage.ErrAlreadyExists) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("created timer for %s in %s\n", name, channel)
+	return nil
+}
+
+type timerActivity struct {
+	indicator   bool
+	lastMessage time.Time
 }
 
 var TIMER_LOCK sync.Mutex = sync.Mutex{}
-var TIMER_MSG_INDICATOR bool = true
-var LAST_MESSAGE time.Time = time.Now()
+var TIMER_ACTIVITY map[string]*timerActivity = map[string]*timerActivity{}
 
-func TimerMarkMessageReceived() {
+// getTimerActivity must be called while holding TIMER_LOCK
+func getTimerActivity(channel string) *timerActivity {
+	channel = normalizeChannel(channel)
+	activity, ok := TIMER_ACTIVITY[channel]
+	if !ok {
+		activity = &timerActivity{
+			indicator:   true,
+			lastMessage: time.Now(),
+		}
+		TIMER_ACTIVITY[channel] = activity
+	}
+	return activity
+}
+
+func TimerMarkMessageReceived(channel string) {
 	TIMER_LOCK.Lock()
 	defer TIMER_LOCK.Unlock()
-	TIMER_MSG_INDICATOR = true
-	LAST_MESSAGE = time.Now()
+	activity := getTimerActivity(channel)
+	activity.indicator = true
+	activity.lastMessage = time.Now()
 }
 
-func HandleTimers(b Bot) error {
+func HandleTimers(b Bot, channel string) error {
 	TIMER_LOCK.Lock()
 	defer TIMER_LOCK.Unlock()
-	if !TIMER_MSG_INDICATOR {
+	activity := getTimerActivity(channel)
+	if !activity.indicator {
 		return nil
 	}
 
-	backer := b.Storage()
+	backer := b.Storage(channel)
+	if backer == nil {
+		return nil
+	}
 	timers, err := backer.ListTimers()
 	if err != nil {
 		return nil
@@ -40,10 +74,14 @@ func HandleTimers(b Bot) error {
 			continue
 		}
 		msg, _, _, err := backer.RetrieveTimer(name)
+		if errors.Is(err, storage.ErrNotFound) {
+			// the timer was deleted since it was listed
+			continue
+		}
 		if err != nil {
 			return err
 		}
-		err = b.Say(msg)
+		err = b.Post(channel, msg, PRIORITY_LOW)
 		if err != nil {
 			return err
 		}
@@ -53,8 +91,8 @@ func HandleTimers(b Bot) error {
 		}
 	}
 
-	if time.Since(LAST_MESSAGE) > (15 * time.Minute) {
-		TIMER_MSG_INDICATOR = false
+	if time.Since(activity.lastMessage) > (15 * time.Minute) {
+		activity.indicator = false
 	}
 
 	return nil